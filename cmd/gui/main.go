@@ -0,0 +1,282 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"syscall/js"
+
+	"github.com/nicholasblaskey/dat-gui-go-wasm/datGUI"
+
+	"github.com/nicholasblaskey/svg-rasterizer/board"
+	"github.com/nicholasblaskey/svg-rasterizer/display"
+	"github.com/nicholasblaskey/svg-rasterizer/rasterizer"
+)
+
+// app presents the output of the rasterizer on a WebGL board.
+type app struct {
+	*display.Viewer
+	r      *rasterizer.Rasterizer
+	board  *board.Board
+	canvas js.Value
+}
+
+func New(canvas js.Value, filePath string) (*app, error) {
+	a := &app{r: rasterizer.New(), canvas: canvas}
+	a.r.SetLoader(httpLoader{})
+
+	b, err := board.New(a.canvas)
+	if err != nil {
+		return nil, err
+	}
+	a.board = b
+	a.Viewer = display.NewViewer(a.r, display.NewWebGL(b, canvas))
+
+	// A broken document shouldn't stop the viewer from starting, another one
+	// can still be picked from the gui.
+	if err := a.LoadSvg(filePath); err != nil {
+		reportError(err)
+	}
+	b.EnablePixelInspector(true)
+
+	return a, nil
+}
+
+// reportError logs errors that can't be returned to anyone to the browser
+// console.
+func reportError(err error) {
+	js.Global().Get("console").Call("error", err.Error())
+}
+
+// httpLoader loads files from the server the viewer is served from.
+type httpLoader struct{}
+
+func (httpLoader) Load(name string) ([]byte, error) {
+	return getFile(getUrl(path.Join("/", name)))
+}
+
+func getUrl(filePath string) string {
+	loc := js.Global().Get("location")
+	url := loc.Get("protocol").String() + "//" +
+		loc.Get("hostname").String() + ":" +
+		loc.Get("port").String()
+
+	return url + filePath
+}
+
+func getFile(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+type testType struct {
+	X   int
+	Y   bool
+	Z   float32
+	W   string
+	Fun func()
+}
+
+func addSvgToGUI(gui *datGUI.GUI, path string, a *app, onSvgLoad func()) {
+	obj := testType{Fun: func() {
+		go func() {
+			if err := a.LoadSvg(path); err != nil {
+				reportError(err)
+				return
+			}
+			onSvgLoad()
+		}()
+	}}
+
+	split := strings.Split(path, "/")
+	name := strings.TrimSuffix(split[len(split)-1], ".svg")
+	funController := gui.Add(&obj, "Fun").Name(name)
+
+	svgIcon := js.Global().Get("document").Call("createElement", "img")
+	svgIcon.Set("background-color", "white")
+	svgIcon.Get("style").Set("background-color", "white")
+	svgIcon.Get("style").Set("float", "right")
+
+	height := 75
+	svgIcon.Set("src", path)
+	svgIcon.Set("height", height)
+	funController.JSController.Get("__li").Get("style").Set("height", height)
+	funController.JSController.Get("domElement").Get("parentElement").Call("appendChild", svgIcon)
+}
+
+func createSvgFolders(gui *datGUI.GUI, a *app, onSvgLoad func()) {
+	style := js.Global().Get("document").Call("createElement", "style")
+	style.Set("innerHTML", `
+    ul.closed > :not(li.title) {
+		display: none;
+    }`)
+	js.Global().Get("document").Get("head").Call("appendChild", style)
+
+	folderNames := []string{"basic", "alpha", "illustration", "hardcore"}
+	svgFiles := [][]string{
+		[]string{"test1", "test2", "test3", "test4", "test5", "test6", "test7"},
+		[]string{"01_prism", "02_cube", "03_buckyball", "04_scotty", "05_sphere"},
+		[]string{"01_sketchpad", "02_hexes", "03_circle", "04_sun", "05_lion",
+			"06_sphere", "07_lines", "08_monkeytree", "09_kochcurve"},
+		[]string{"01_degenerate_square1", "02_degenerate_square2"},
+	}
+
+	svgImagesGUI := gui.AddFolder("svg images")
+	svgImagesGUI.Open()
+	for i, folder := range folderNames {
+		folderGUI := svgImagesGUI.AddFolder(folder)
+
+		//if folder == "alpha" {
+		if folder == "illustration" {
+			folderGUI.Open()
+		}
+		for _, svgFile := range svgFiles[i] {
+			addSvgToGUI(folderGUI, "/svg/"+folder+"/"+svgFile+".svg", a, onSvgLoad)
+		}
+	}
+}
+
+type guiValues struct {
+	SuperSampleRate         int
+	TargetScale             float32
+	CanvasScale             float32
+	WidthHeightPixelInspect int
+	PixelInspectorOn        bool
+	PixelInspectorScale     float32
+}
+
+func createGui(a *app) {
+	gui := datGUI.New()
+	gui.JSGUI.Set("width", 300)
+
+	guiVals := guiValues{
+		SuperSampleRate:         1,
+		TargetScale:             100,
+		CanvasScale:             100,
+		PixelInspectorOn:        true,
+		PixelInspectorScale:     30,
+		WidthHeightPixelInspect: 25,
+	}
+
+	// Pixel inspector GUI
+	pixelGui := gui.AddFolder("Pixel inspector")
+	pixelGui.Open()
+	pixelGui.Add(&guiVals, "PixelInspectorOn").Name("Inspector on?").OnChange(func() {
+		a.board.EnablePixelInspector(guiVals.PixelInspectorOn)
+	})
+	pixelGui.Add(&guiVals, "PixelInspectorScale").Min(5).Max(
+		80).Name("Inspector size").OnChange(func() {
+		a.board.SetInspectorSize(guiVals.PixelInspectorScale / 100.0)
+	})
+	pixelGui.Add(&guiVals, "WidthHeightPixelInspect").Min(1).Max(
+		100).Name("Width Height (px)").OnChange(func() {
+		a.board.SetWidthHeightPixelInspector(guiVals.WidthHeightPixelInspect)
+	})
+
+	// Rasterizer GUI
+	rasterizerGui := gui.AddFolder("Rasterizer settings")
+	rasterizerGui.Open()
+	rasterizerGui.Add(&guiVals,
+		"SuperSampleRate").Min(1).Max(8).Name("Super sample rate").OnChange(func() {
+		if a.r.SampleRate() == guiVals.SuperSampleRate {
+			return
+		}
+
+		a.r.SetSampleRate(guiVals.SuperSampleRate)
+		if err := a.Draw(); err != nil {
+			reportError(err)
+		}
+	})
+
+	setCanvasScale := func() {
+		scaleVal := (guiVals.CanvasScale / 100.0) * (guiVals.TargetScale / 100.0)
+		a.canvas.Set("width", scaleVal*float32(a.r.UnscaledWidth()))
+		a.canvas.Set("height", scaleVal*float32(a.r.UnscaledHeight()))
+		a.board.Draw()
+	}
+	targetScaleController := rasterizerGui.Add(&guiVals,
+		"TargetScale").Min(1).Max(200).Step(
+		0.1).Name("Target scale %").OnChange(func() {
+		if err := a.SetTargetScale(guiVals.TargetScale / 100.0); err != nil {
+			reportError(err)
+		}
+
+		setCanvasScale()
+	})
+	canvasScaleController := rasterizerGui.Add(&guiVals,
+		"CanvasScale").Min(1).Max(500).Step(
+		0.1).Name("Canvas scale %").OnChange(func() {
+		setCanvasScale()
+	})
+
+	onSvgLoad := func() {
+		canvasScaleController.SetValue(100)
+		targetScaleController.SetValue(100)
+	}
+
+	// SVG options GUI
+	createSvgFolders(gui, a, onSvgLoad)
+}
+
+func main() {
+	document := js.Global().Get("document")
+	canvas := document.Call("getElementById", "webgl")
+	canvas.Get("style").Set("border-style", "solid")
+
+	//r, err := New(canvas, "/svg/basic/test1.svg")
+	//r, err := New(canvas, "/svg/basic/test2.svg")
+	//r, err := New(canvas, "/svg/basic/test3.svg")
+	//r, err := New(canvas, "/svg/basic/test4.svg")
+	//r, err := New(canvas, "/svg/basic/test5.svg")
+	//r, err := New(canvas, "/svg/basic/test6.svg")
+	//r, err := New(canvas, "/svg/basic/test7.svg")
+
+	//r, err := New(canvas, "/svg/alpha/01_prism.svg")
+	//r, err := New(canvas, "/svg/alpha/02_cube.svg")
+	//r, err := New(canvas, "/svg/alpha/03_buckyball.svg")
+	//r, err := New(canvas, "/svg/alpha/04_scotty.svg")
+	//r, err := New(canvas, "/svg/alpha/05_sphere.svg")
+
+	//r, err := New(canvas, "/svg/illustration/01_sketchpad.svg")
+	//r, err := New(canvas, "/svg/illustration/02_hexes.svg")
+	//r, err := New(canvas, "/svg/illustration/03_circle.svg")
+	//r, err := New(canvas, "/svg/illustration/04_sun.svg")
+	a, err := New(canvas, "/svg/illustration/05_lion.svg")
+	//r, err := New(canvas, "/svg/illustration/06_sphere.svg")
+	//r, err := New(canvas, "/svg/illustration/07_lines.svg")
+	//r, err := New(canvas, "/svg/illustration/08_monkeytree.svg")
+	//r, err := New(canvas, "/svg/illustration/09_kochcurve.svg")
+
+	//r, err := New(canvas, "/svg/hardcore/01_degenerate_square1.svg")
+	//r, err := New(canvas, "/svg/hardcore/02_degenerate_square2.svg")
+
+	//r.SetSvg("/svg/illustration/01_sketchpad.svg")
+
+	if err != nil {
+		panic(err)
+	}
+
+	createGui(a)
+	/*
+		canvas.Set("height", 900)
+		canvas.Set("width", 900)
+	*/
+
+	fmt.Println("starting", rand.Int31n(256))
+
+	<-make(chan bool) // Prevent program from exiting
+}
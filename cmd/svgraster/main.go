@@ -0,0 +1,163 @@
+// Command svgraster renders an SVG file to a PNG.
+//
+//	svgraster [flags] input.svg
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nicholasblaskey/svg-rasterizer/rasterizer"
+)
+
+var (
+	output     = flag.String("o", "", "output png path (defaults to the input path with a .png extension)")
+	scale      = flag.Float64("scale", 1.0, "target scale relative to the size declared by the document")
+	sampleRate = flag.Int("samples", 1, "super sample rate, each pixel averages samples x samples points")
+	width      = flag.Int("width", 0, "output width in pixels, overrides -scale")
+	height     = flag.Int("height", 0, "output height in pixels, overrides -scale")
+	timeout    = flag.Duration("timeout", 0, "give up rendering after this long, 0 waits forever")
+	progress   = flag.Bool("progress", false, "report rendering progress on stderr")
+	fonts      = flag.String("fonts", "", "directory of TrueType and OpenType fonts for text")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: svgraster [flags] input.svg\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := checkFlags(); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), "svgraster:", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	input := flag.Arg(0)
+	outPath := *output
+	if outPath == "" {
+		outPath = strings.TrimSuffix(input, filepath.Ext(input)) + ".png"
+	}
+
+	if err := render(input, outPath); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func render(input, outPath string) error {
+	// Images linked from the document are loaded relative to it.
+	r := rasterizer.New()
+	r.SetLoader(rasterizer.FSLoader(os.DirFS(filepath.Dir(input))))
+	r.SetSampleRate(*sampleRate)
+	if *fonts != "" {
+		if err := r.LoadFonts(*fonts); err != nil {
+			return err
+		}
+	}
+	if err := r.LoadSvg(filepath.Base(input)); err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if *progress {
+		r.SetProgressFunc(reportProgress)
+	}
+
+	var img image.Image
+	if *width > 0 && *height > 0 {
+		// Center the document on a white canvas of exactly the requested size.
+		canvas := image.NewRGBA(image.Rect(0, 0, *width, *height))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		if err := r.DrawIntoContext(ctx, canvas, canvas.Bounds()); err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		img = canvas
+	} else {
+		if err := r.SetTargetScale(targetScale(r)); err != nil {
+			return err
+		}
+		rgba, err := r.DrawContext(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		img = rgba
+	}
+
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var lastPercent = -1
+
+// reportProgress prints the percentage of the draw that is done whenever it
+// changes.
+func reportProgress(p rasterizer.Progress) {
+	percent := 100
+	if total := p.TotalElements + p.TotalRows; total > 0 {
+		percent = (p.Elements + p.Rows) * 100 / total
+	}
+	if percent == lastPercent {
+		return
+	}
+	lastPercent = percent
+
+	fmt.Fprintf(os.Stderr, "\rrendering %3d%%", percent)
+	if percent == 100 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// targetScale picks the scale that gives the requested width or height,
+// following the aspect ratio of the document.
+func targetScale(r *rasterizer.Rasterizer) float32 {
+	w, h := float32(r.UnscaledWidth()), float32(r.UnscaledHeight())
+	switch {
+	case *width > 0:
+		return float32(*width) / w
+	case *height > 0:
+		return float32(*height) / h
+	}
+	return float32(*scale)
+}
+
+// checkFlags rejects sizes and rates given on the command line that leave
+// nothing to render.
+func checkFlags() error {
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "scale", "width", "height", "samples":
+			v, _ := strconv.ParseFloat(f.Value.String(), 64)
+			if !(v > 0) && err == nil {
+				err = fmt.Errorf("-%s has to be above 0, got %s", f.Name, f.Value)
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,64 @@
+// Package display presents the output of a rasterizer, be it on a WebGL
+// canvas, in a file, in memory or on a terminal.
+package display
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/nicholasblaskey/svg-rasterizer/rasterizer"
+)
+
+// Display is something rendered documents are shown on.
+type Display interface {
+	// SetWidthHeight is called with the size in pixels of the frames that
+	// follow.
+	SetWidthHeight(w, h int)
+	// ResetView undoes any panning or zooming, such as when a new document is
+	// loaded.
+	ResetView()
+	// SetPixels shows a frame. Rows are stored top to bottom.
+	SetPixels(img *image.RGBA) error
+	EnablePixelInspector(on bool)
+}
+
+// Viewer keeps a Display showing the output of a Rasterizer.
+type Viewer struct {
+	r *rasterizer.Rasterizer
+	d Display
+}
+
+func NewViewer(r *rasterizer.Rasterizer, d Display) *Viewer {
+	return &Viewer{r: r, d: d}
+}
+
+// LoadSvg loads the named document with the loader of the rasterizer and
+// shows it with the view reset.
+func (v *Viewer) LoadSvg(name string) error {
+	if err := v.r.LoadSvg(name); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	v.d.SetWidthHeight(v.r.Width(), v.r.Height())
+	v.d.ResetView()
+
+	return v.Draw()
+}
+
+func (v *Viewer) SetTargetScale(scale float32) error {
+	if err := v.r.SetTargetScale(scale); err != nil {
+		return err
+	}
+	v.d.SetWidthHeight(v.r.Width(), v.r.Height())
+
+	return v.Draw()
+}
+
+// Draw rasterizes the current document again and shows the result.
+func (v *Viewer) Draw() error {
+	img, err := v.r.Draw()
+	if err != nil {
+		return err
+	}
+	return v.d.SetPixels(img)
+}
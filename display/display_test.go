@@ -0,0 +1,89 @@
+package display
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nicholasblaskey/svg-rasterizer/rasterizer"
+)
+
+func newTestViewer(t *testing.T) (*Viewer, *Memory) {
+	t.Helper()
+	r := rasterizer.New()
+	r.SetLoader(rasterizer.FSLoader(fstest.MapFS{
+		"square.svg": {Data: []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="4" height="2">` +
+			`<rect width="2" height="2" fill="red"/></svg>`)},
+	}))
+	m := &Memory{}
+	return NewViewer(r, m), m
+}
+
+func TestViewerLoadSvg(t *testing.T) {
+	v, m := newTestViewer(t)
+	if err := v.LoadSvg("square.svg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Width != 4 || m.Height != 2 {
+		t.Errorf("size = %dx%d, want 4x2", m.Width, m.Height)
+	}
+	if m.ViewResets != 1 || m.Frames != 1 {
+		t.Errorf("view resets = %d, frames = %d, want 1 and 1", m.ViewResets, m.Frames)
+	}
+	if b := m.Pixels.Bounds(); b.Dx() != m.Width || b.Dy() != m.Height {
+		t.Errorf("frame bounds %v don't match the size %dx%d", b, m.Width, m.Height)
+	}
+	for _, p := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{255, 0, 0, 255}},
+		{1, 1, color.RGBA{255, 0, 0, 255}},
+		{3, 0, color.RGBA{255, 255, 255, 255}},
+	} {
+		if got := m.Pixels.RGBAAt(p.x, p.y); got != p.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", p.x, p.y, got, p.want)
+		}
+	}
+}
+
+func TestViewerSetTargetScale(t *testing.T) {
+	v, m := newTestViewer(t)
+	if err := v.LoadSvg("square.svg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetTargetScale(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Width != 8 || m.Height != 4 {
+		t.Errorf("size = %dx%d, want 8x4", m.Width, m.Height)
+	}
+	if b := m.Pixels.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Errorf("frame bounds = %v, want 8x4", b)
+	}
+	// Scaling keeps the view where it was.
+	if m.ViewResets != 1 || m.Frames != 2 {
+		t.Errorf("view resets = %d, frames = %d, want 1 and 2", m.ViewResets, m.Frames)
+	}
+
+	if err := v.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Frames != 3 {
+		t.Errorf("frames = %d after drawing again, want 3", m.Frames)
+	}
+}
+
+func TestViewerLoadSvgError(t *testing.T) {
+	v, m := newTestViewer(t)
+	err := v.LoadSvg("missing.svg")
+	if err == nil || !strings.HasPrefix(err.Error(), "missing.svg: ") {
+		t.Errorf("error = %v, want one starting with the name of the document", err)
+	}
+	if m.Frames != 0 || m.ViewResets != 0 {
+		t.Errorf("view resets = %d, frames = %d, want nothing shown", m.ViewResets, m.Frames)
+	}
+}
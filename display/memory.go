@@ -0,0 +1,32 @@
+package display
+
+import "image"
+
+// Memory records what is presented to it so it can be inspected afterwards,
+// such as from tests.
+type Memory struct {
+	Width          int
+	Height         int
+	Pixels         *image.RGBA // The last frame.
+	Frames         int
+	ViewResets     int
+	PixelInspector bool
+}
+
+func (m *Memory) SetWidthHeight(w, h int) {
+	m.Width, m.Height = w, h
+}
+
+func (m *Memory) ResetView() {
+	m.ViewResets++
+}
+
+func (m *Memory) SetPixels(img *image.RGBA) error {
+	m.Pixels = img
+	m.Frames++
+	return nil
+}
+
+func (m *Memory) EnablePixelInspector(on bool) {
+	m.PixelInspector = on
+}
@@ -0,0 +1,35 @@
+package display
+
+import (
+	"image"
+	"image/png"
+	"os"
+)
+
+// PNG writes every frame presented to it to a file, replacing the previous
+// one.
+type PNG struct {
+	path string
+}
+
+func NewPNG(path string) *PNG {
+	return &PNG{path: path}
+}
+
+func (p *PNG) SetWidthHeight(w, h int) {}
+
+func (p *PNG) ResetView() {}
+
+func (p *PNG) SetPixels(img *image.RGBA) error {
+	f, err := os.Create(p.path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (p *PNG) EnablePixelInspector(on bool) {}
@@ -0,0 +1,71 @@
+package display
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Terminal previews frames on a terminal that supports 24 bit color. Each
+// character cell shows two pixels stacked on top of each other, frames wider
+// than the terminal are shrunk to fit.
+type Terminal struct {
+	w       io.Writer
+	columns int
+}
+
+func NewTerminal(w io.Writer, columns int) *Terminal {
+	if columns < 1 {
+		columns = 1
+	}
+	return &Terminal{w: w, columns: columns}
+}
+
+func (t *Terminal) SetWidthHeight(w, h int) {}
+
+func (t *Terminal) ResetView() {}
+
+func (t *Terminal) SetPixels(img *image.RGBA) error {
+	b := img.Bounds()
+	step := (b.Dx() + t.columns - 1) / t.columns
+	if step < 1 {
+		step = 1
+	}
+
+	out := bufio.NewWriter(t.w)
+	for y := b.Min.Y; y < b.Max.Y; y += 2 * step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			top := average(img, image.Rect(x, y, x+step, y+step))
+			bottom := average(img, image.Rect(x, y+step, x+step, y+2*step))
+			// The upper half block is drawn in the foreground color.
+			fmt.Fprintf(out, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+				top[0], top[1], top[2], bottom[0], bottom[1], bottom[2])
+		}
+		fmt.Fprint(out, "\x1b[0m\n")
+	}
+	return out.Flush()
+}
+
+func (t *Terminal) EnablePixelInspector(on bool) {}
+
+// average returns the mean color of the pixels of img within rect. Parts
+// outside of img count as white.
+func average(img *image.RGBA, rect image.Rectangle) [3]int {
+	var sum [3]int
+	n := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			n++
+			if !(image.Point{x, y}).In(img.Rect) {
+				sum[0], sum[1], sum[2] = sum[0]+255, sum[1]+255, sum[2]+255
+				continue
+			}
+			i := img.PixOffset(x, y)
+			sum[0] += int(img.Pix[i])
+			sum[1] += int(img.Pix[i+1])
+			sum[2] += int(img.Pix[i+2])
+		}
+	}
+	return [3]int{sum[0] / n, sum[1] / n, sum[2] / n}
+}
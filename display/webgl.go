@@ -0,0 +1,43 @@
+//go:build js && wasm
+// +build js,wasm
+
+package display
+
+import (
+	"image"
+	"syscall/js"
+
+	"github.com/nicholasblaskey/svg-rasterizer/board"
+)
+
+// WebGL shows frames on a board, sizing the canvas of the board to match.
+type WebGL struct {
+	*board.Board
+	canvas js.Value
+}
+
+func NewWebGL(b *board.Board, canvas js.Value) *WebGL {
+	return &WebGL{Board: b, canvas: canvas}
+}
+
+func (g *WebGL) SetWidthHeight(w, h int) {
+	g.Board.SetWidthHeight(w, h)
+	g.canvas.Set("width", w)
+	g.canvas.Set("height", h)
+}
+
+func (g *WebGL) SetPixels(img *image.RGBA) error {
+	g.Board.SetPixels(flipRows(img))
+	return nil
+}
+
+// The board expects the bottom row of pixels first.
+func flipRows(img *image.RGBA) []byte {
+	h := img.Rect.Dy()
+	flipped := make([]byte, len(img.Pix))
+	for y := 0; y < h; y++ {
+		copy(flipped[y*img.Stride:(y+1)*img.Stride],
+			img.Pix[(h-1-y)*img.Stride:(h-y)*img.Stride])
+	}
+	return flipped
+}
@@ -7,9 +7,10 @@ require (
 	github.com/nicholasblaskey/dat-gui-go-wasm v0.0.0
 	github.com/nicholasblaskey/webgl v0.0.0
 	github.com/nicholasblaskey/webgl-utils v0.0.0
+	golang.org/x/image v0.0.0-20190321063152-3fc05d484e9f
 )
 
-require golang.org/x/image v0.0.0-20190321063152-3fc05d484e9f // indirect
+require golang.org/x/text v0.3.0 // indirect
 
 replace github.com/nicholasblaskey/webgl v0.0.0 => ../webgl
 
@@ -0,0 +1,350 @@
+package rasterizer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseColor parses a CSS color such as "#f80", "orange", "rgb(255 128 0 /
+// 50%)" or "hsl(30, 100%, 50%)". paint is false for "none", which paints
+// nothing. A currentColor that the parser didn't resolve is black, the
+// initial value of color.
+func parseColor(s string) (col Color, paint bool, err error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case v == "none":
+		return Color{}, false, nil
+	case v == "transparent":
+		return Color{}, true, nil
+	case v == "currentcolor":
+		return Color{0, 0, 0, 1}, true, nil
+	case strings.HasPrefix(v, "#"):
+		col, err = parseHexColor(v[1:])
+	case len(v) == 6 && isHex(v):
+		// Six hex digits without the # are accepted as well.
+		col, err = parseHexColor(v)
+	case strings.HasSuffix(v, ")"):
+		col, err = parseColorFunction(v)
+	default:
+		named, ok := namedColors[v]
+		if !ok {
+			return Color{}, false, fmt.Errorf("invalid color %q", s)
+		}
+		col = Color{float32(named[0]) / 255, float32(named[1]) / 255, float32(named[2]) / 255, 1}
+	}
+	if err != nil {
+		return Color{}, false, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return col, true, nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHexColor parses the digits of #rgb, #rgba, #rrggbb or #rrggbbaa.
+func parseHexColor(digits string) (Color, error) {
+	if !isHex(digits) {
+		return Color{}, fmt.Errorf("%q isn't hexadecimal", digits)
+	}
+	var channels [4]float32
+	channels[3] = 1
+	switch len(digits) {
+	case 3, 4:
+		for i := range digits {
+			d, _ := strconv.ParseUint(digits[i:i+1], 16, 8)
+			channels[i] = float32(d*17) / 255
+		}
+	case 6, 8:
+		for i := 0; i < len(digits); i += 2 {
+			d, _ := strconv.ParseUint(digits[i:i+2], 16, 8)
+			channels[i/2] = float32(d) / 255
+		}
+	default:
+		return Color{}, fmt.Errorf("expected 3, 4, 6 or 8 digits, got %d", len(digits))
+	}
+	return Color{channels[0], channels[1], channels[2], channels[3]}, nil
+}
+
+// parseColorFunction parses rgb(), rgba(), hsl() and hsla() in either their
+// comma separated or space separated forms.
+func parseColorFunction(v string) (Color, error) {
+	open := strings.IndexByte(v, '(')
+	if open < 0 {
+		return Color{}, fmt.Errorf("missing (")
+	}
+	name, args := strings.TrimSpace(v[:open]), v[open+1:len(v)-1]
+
+	var values []string
+	alpha := "1"
+	if strings.Contains(args, ",") {
+		values = strings.Split(args, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		if len(values) == 4 {
+			alpha, values = values[3], values[:3]
+		}
+	} else {
+		if slash := strings.IndexByte(args, '/'); slash >= 0 {
+			alpha, args = strings.TrimSpace(args[slash+1:]), args[:slash]
+		}
+		values = strings.Fields(args)
+	}
+	if len(values) != 3 {
+		return Color{}, fmt.Errorf("expected 3 values and an alpha, got %d values", len(values))
+	}
+
+	a, err := colorValue(alpha, 1)
+	if err != nil {
+		return Color{}, err
+	}
+	var col Color
+	switch name {
+	case "rgb", "rgba":
+		var channels [3]float32
+		for i, value := range values {
+			c, err := colorValue(value, 255)
+			if err != nil {
+				return Color{}, err
+			}
+			channels[i] = c
+		}
+		col = Color{channels[0], channels[1], channels[2], 0}
+	case "hsl", "hsla":
+		hue, err := parseHue(values[0])
+		if err != nil {
+			return Color{}, err
+		}
+		saturation, err := colorValue(values[1], 100)
+		if err != nil {
+			return Color{}, err
+		}
+		lightness, err := colorValue(values[2], 100)
+		if err != nil {
+			return Color{}, err
+		}
+		col = hslToRGB(hue, saturation, lightness)
+	default:
+		return Color{}, fmt.Errorf("unknown function %q", name)
+	}
+	col.a = a
+	return col, nil
+}
+
+// colorValue parses a number out of max or a percentage and returns it as a
+// fraction clamped to 0 to 1.
+func colorValue(v string, max float64) (float32, error) {
+	scale := max
+	if strings.HasSuffix(v, "%") {
+		v, scale = strings.TrimSuffix(v, "%"), 100
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	return float32(math.Min(math.Max(f/scale, 0), 1)), nil
+}
+
+// parseHue returns an angle, in degrees unless it has a unit, as turns.
+func parseHue(v string) (float64, error) {
+	units := []struct {
+		suffix string
+		turn   float64
+	}{{"deg", 360}, {"grad", 400}, {"rad", 2 * math.Pi}, {"turn", 1}, {"", 360}}
+	for _, u := range units {
+		if !strings.HasSuffix(v, u.suffix) {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, u.suffix), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid angle %q", v)
+		}
+		turns := f / u.turn
+		return turns - math.Floor(turns), nil
+	}
+	return 0, nil
+}
+
+func hslToRGB(hue float64, saturation, lightness float32) Color {
+	s, l := float64(saturation), float64(lightness)
+	var t2 float64
+	if l <= 0.5 {
+		t2 = l * (s + 1)
+	} else {
+		t2 = l + s - l*s
+	}
+	t1 := l*2 - t2
+	channel := func(h float64) float32 {
+		h -= math.Floor(h)
+		switch {
+		case h*6 < 1:
+			return float32(t1 + (t2-t1)*h*6)
+		case h*2 < 1:
+			return float32(t2)
+		case h*3 < 2:
+			return float32(t1 + (t2-t1)*(2.0/3-h)*6)
+		}
+		return float32(t1)
+	}
+	return Color{channel(hue + 1.0/3), channel(hue), channel(hue - 1.0/3), 1}
+}
+
+// namedColors are the CSS color keywords.
+var namedColors = map[string][3]uint8{
+	"aliceblue":            {240, 248, 255},
+	"antiquewhite":         {250, 235, 215},
+	"aqua":                 {0, 255, 255},
+	"aquamarine":           {127, 255, 212},
+	"azure":                {240, 255, 255},
+	"beige":                {245, 245, 220},
+	"bisque":               {255, 228, 196},
+	"black":                {0, 0, 0},
+	"blanchedalmond":       {255, 235, 205},
+	"blue":                 {0, 0, 255},
+	"blueviolet":           {138, 43, 226},
+	"brown":                {165, 42, 42},
+	"burlywood":            {222, 184, 135},
+	"cadetblue":            {95, 158, 160},
+	"chartreuse":           {127, 255, 0},
+	"chocolate":            {210, 105, 30},
+	"coral":                {255, 127, 80},
+	"cornflowerblue":       {100, 149, 237},
+	"cornsilk":             {255, 248, 220},
+	"crimson":              {220, 20, 60},
+	"cyan":                 {0, 255, 255},
+	"darkblue":             {0, 0, 139},
+	"darkcyan":             {0, 139, 139},
+	"darkgoldenrod":        {184, 134, 11},
+	"darkgray":             {169, 169, 169},
+	"darkgreen":            {0, 100, 0},
+	"darkgrey":             {169, 169, 169},
+	"darkkhaki":            {189, 183, 107},
+	"darkmagenta":          {139, 0, 139},
+	"darkolivegreen":       {85, 107, 47},
+	"darkorange":           {255, 140, 0},
+	"darkorchid":           {153, 50, 204},
+	"darkred":              {139, 0, 0},
+	"darksalmon":           {233, 150, 122},
+	"darkseagreen":         {143, 188, 143},
+	"darkslateblue":        {72, 61, 139},
+	"darkslategray":        {47, 79, 79},
+	"darkslategrey":        {47, 79, 79},
+	"darkturquoise":        {0, 206, 209},
+	"darkviolet":           {148, 0, 211},
+	"deeppink":             {255, 20, 147},
+	"deepskyblue":          {0, 191, 255},
+	"dimgray":              {105, 105, 105},
+	"dimgrey":              {105, 105, 105},
+	"dodgerblue":           {30, 144, 255},
+	"firebrick":            {178, 34, 34},
+	"floralwhite":          {255, 250, 240},
+	"forestgreen":          {34, 139, 34},
+	"fuchsia":              {255, 0, 255},
+	"gainsboro":            {220, 220, 220},
+	"ghostwhite":           {248, 248, 255},
+	"gold":                 {255, 215, 0},
+	"goldenrod":            {218, 165, 32},
+	"gray":                 {128, 128, 128},
+	"grey":                 {128, 128, 128},
+	"green":                {0, 128, 0},
+	"greenyellow":          {173, 255, 47},
+	"honeydew":             {240, 255, 240},
+	"hotpink":              {255, 105, 180},
+	"indianred":            {205, 92, 92},
+	"indigo":               {75, 0, 130},
+	"ivory":                {255, 255, 240},
+	"khaki":                {240, 230, 140},
+	"lavender":             {230, 230, 250},
+	"lavenderblush":        {255, 240, 245},
+	"lawngreen":            {124, 252, 0},
+	"lemonchiffon":         {255, 250, 205},
+	"lightblue":            {173, 216, 230},
+	"lightcoral":           {240, 128, 128},
+	"lightcyan":            {224, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210},
+	"lightgray":            {211, 211, 211},
+	"lightgreen":           {144, 238, 144},
+	"lightgrey":            {211, 211, 211},
+	"lightpink":            {255, 182, 193},
+	"lightsalmon":          {255, 160, 122},
+	"lightseagreen":        {32, 178, 170},
+	"lightskyblue":         {135, 206, 250},
+	"lightslategray":       {119, 136, 153},
+	"lightslategrey":       {119, 136, 153},
+	"lightsteelblue":       {176, 196, 222},
+	"lightyellow":          {255, 255, 224},
+	"lime":                 {0, 255, 0},
+	"limegreen":            {50, 205, 50},
+	"linen":                {250, 240, 230},
+	"magenta":              {255, 0, 255},
+	"maroon":               {128, 0, 0},
+	"mediumaquamarine":     {102, 205, 170},
+	"mediumblue":           {0, 0, 205},
+	"mediumorchid":         {186, 85, 211},
+	"mediumpurple":         {147, 112, 219},
+	"mediumseagreen":       {60, 179, 113},
+	"mediumslateblue":      {123, 104, 238},
+	"mediumspringgreen":    {0, 250, 154},
+	"mediumturquoise":      {72, 209, 204},
+	"mediumvioletred":      {199, 21, 133},
+	"midnightblue":         {25, 25, 112},
+	"mintcream":            {245, 255, 250},
+	"mistyrose":            {255, 228, 225},
+	"moccasin":             {255, 228, 181},
+	"navajowhite":          {255, 222, 173},
+	"navy":                 {0, 0, 128},
+	"oldlace":              {253, 245, 230},
+	"olive":                {128, 128, 0},
+	"olivedrab":            {107, 142, 35},
+	"orange":               {255, 165, 0},
+	"orangered":            {255, 69, 0},
+	"orchid":               {218, 112, 214},
+	"palegoldenrod":        {238, 232, 170},
+	"palegreen":            {152, 251, 152},
+	"paleturquoise":        {175, 238, 238},
+	"palevioletred":        {219, 112, 147},
+	"papayawhip":           {255, 239, 213},
+	"peachpuff":            {255, 218, 185},
+	"peru":                 {205, 133, 63},
+	"pink":                 {255, 192, 203},
+	"plum":                 {221, 160, 221},
+	"powderblue":           {176, 224, 230},
+	"purple":               {128, 0, 128},
+	"rebeccapurple":        {102, 51, 153},
+	"red":                  {255, 0, 0},
+	"rosybrown":            {188, 143, 143},
+	"royalblue":            {65, 105, 225},
+	"saddlebrown":          {139, 69, 19},
+	"salmon":               {250, 128, 114},
+	"sandybrown":           {244, 164, 96},
+	"seagreen":             {46, 139, 87},
+	"seashell":             {255, 245, 238},
+	"sienna":               {160, 82, 45},
+	"silver":               {192, 192, 192},
+	"skyblue":              {135, 206, 235},
+	"slateblue":            {106, 90, 205},
+	"slategray":            {112, 128, 144},
+	"slategrey":            {112, 128, 144},
+	"snow":                 {255, 250, 250},
+	"springgreen":          {0, 255, 127},
+	"steelblue":            {70, 130, 180},
+	"tan":                  {210, 180, 140},
+	"teal":                 {0, 128, 128},
+	"thistle":              {216, 191, 216},
+	"tomato":               {255, 99, 71},
+	"turquoise":            {64, 224, 208},
+	"violet":               {238, 130, 238},
+	"wheat":                {245, 222, 179},
+	"white":                {255, 255, 255},
+	"whitesmoke":           {245, 245, 245},
+	"yellow":               {255, 255, 0},
+	"yellowgreen":          {154, 205, 50},
+}
@@ -0,0 +1,64 @@
+package rasterizer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		want  Color
+		paint bool
+	}{
+		{"none", Color{}, false},
+		{" None ", Color{}, false},
+		{"transparent", Color{}, true},
+		{"currentColor", Color{0, 0, 0, 1}, true},
+		{"#abc", Color{0xaa / 255.0, 0xbb / 255.0, 0xcc / 255.0, 1}, true},
+		{"#ABC8", Color{0xaa / 255.0, 0xbb / 255.0, 0xcc / 255.0, 0x88 / 255.0}, true},
+		{"#ff8000", Color{1, 0x80 / 255.0, 0, 1}, true},
+		{"ff8000", Color{1, 0x80 / 255.0, 0, 1}, true},
+		{"#ff800080", Color{1, 0x80 / 255.0, 0, 0x80 / 255.0}, true},
+		{"red", Color{1, 0, 0, 1}, true},
+		{"CornflowerBlue", Color{100 / 255.0, 149 / 255.0, 237 / 255.0, 1}, true},
+		{"rgb(255,0,0)", Color{1, 0, 0, 1}, true},
+		{"rgba(0, 255, 0, 0.5)", Color{0, 1, 0, 0.5}, true},
+		{"rgb(0 0 255 / 25%)", Color{0, 0, 1, 0.25}, true},
+		{"rgb(100%, 50%, 0%)", Color{1, 0.5, 0, 1}, true},
+		// Out of range values are clamped.
+		{"rgb(300, -10, 0)", Color{1, 0, 0, 1}, true},
+		{"hsl(120, 100%, 50%)", Color{0, 1, 0, 1}, true},
+		{"hsla(240, 100%, 50%, 0.5)", Color{0, 0, 1, 0.5}, true},
+		{"hsl(0.5turn 100% 25% / 1)", Color{0, 0.5, 0.5, 1}, true},
+		{"hsl(-120deg, 100%, 50%)", Color{0, 0, 1, 1}, true},
+		{"hsl(0, 0%, 100%)", Color{1, 1, 1, 1}, true},
+	} {
+		got, paint, err := parseColor(test.in)
+		if err != nil {
+			t.Errorf("parseColor(%q) returned error %v", test.in, err)
+			continue
+		}
+		if paint != test.paint || !closeColors(got, test.want) {
+			t.Errorf("parseColor(%q) = %v, %v, want %v, %v", test.in, got, paint, test.want, test.paint)
+		}
+	}
+}
+
+func TestParseColorErrors(t *testing.T) {
+	for _, in := range []string{
+		"", "#", "#ab", "#abcde", "#ggg", "bluish", "12345",
+		"rgb(1, 2)", "rgb(1 2 3 4)", "rgb(a, b, c)", "rgb(1, 2, 3",
+		"hsl(x, 100%, 50%)", "cmyk(0, 0, 0, 1)",
+	} {
+		if got, _, err := parseColor(in); err == nil {
+			t.Errorf("parseColor(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func closeColors(a, b Color) bool {
+	const epsilon = 1e-3
+	return math.Abs(float64(a.r-b.r)) < epsilon && math.Abs(float64(a.g-b.g)) < epsilon &&
+		math.Abs(float64(a.b-b.b)) < epsilon && math.Abs(float64(a.a-b.a)) < epsilon
+}
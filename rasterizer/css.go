@@ -0,0 +1,507 @@
+package rasterizer
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// presentationProperties are the properties that can be set both as an
+// attribute and from css. The rest of the attributes of an element are never
+// styled.
+var presentationProperties = map[string]bool{
+	"clip-rule":         true,
+	"color":             true,
+	"display":           true,
+	"fill":              true,
+	"fill-opacity":      true,
+	"fill-rule":         true,
+	"font-family":       true,
+	"font-size":         true,
+	"font-style":        true,
+	"font-weight":       true,
+	"marker-end":        true,
+	"marker-mid":        true,
+	"marker-start":      true,
+	"opacity":           true,
+	"overflow":          true,
+	"stop-color":        true,
+	"stop-opacity":      true,
+	"stroke":            true,
+	"stroke-linecap":    true,
+	"stroke-linejoin":   true,
+	"stroke-miterlimit": true,
+	"stroke-opacity":    true,
+	"stroke-width":      true,
+	"text-anchor":       true,
+	"visibility":        true,
+}
+
+// inheritedProperties are taken from the element around an element that
+// doesn't set them. Visibility is inherited too, but while drawing, so that
+// an element can be made visible inside a hidden one.
+var inheritedProperties = map[string]bool{
+	"clip-rule":         true,
+	"color":             true,
+	"fill":              true,
+	"fill-opacity":      true,
+	"fill-rule":         true,
+	"font-family":       true,
+	"font-size":         true,
+	"font-style":        true,
+	"font-weight":       true,
+	"marker-end":        true,
+	"marker-mid":        true,
+	"marker-start":      true,
+	"stroke":            true,
+	"stroke-linecap":    true,
+	"stroke-linejoin":   true,
+	"stroke-miterlimit": true,
+	"stroke-opacity":    true,
+	"stroke-width":      true,
+	"text-anchor":       true,
+}
+
+// initialValues are what initial stands for. A property missing here is
+// left unset, which elements treat as their default.
+var initialValues = map[string]string{
+	"clip-rule":         "nonzero",
+	"color":             "black",
+	"display":           "inline",
+	"fill":              "black",
+	"fill-opacity":      "1",
+	"fill-rule":         "nonzero",
+	"font-size":         "16",
+	"font-style":        "normal",
+	"font-weight":       "normal",
+	"marker-end":        "none",
+	"marker-mid":        "none",
+	"marker-start":      "none",
+	"opacity":           "1",
+	"overflow":          "visible",
+	"stop-color":        "black",
+	"stop-opacity":      "1",
+	"stroke":            "none",
+	"stroke-linecap":    "butt",
+	"stroke-linejoin":   "miter",
+	"stroke-miterlimit": "4",
+	"stroke-opacity":    "1",
+	"stroke-width":      "1",
+	"text-anchor":       "start",
+	"visibility":        "visible",
+}
+
+type declaration struct {
+	name      string // Lower case.
+	value     string
+	important bool
+}
+
+// cssRule is the declarations of a ruleset for one of its selectors.
+type cssRule struct {
+	selector     selector
+	specificity  [3]int // Ids, classes and types.
+	order        int    // Position in the style sheets of the document.
+	declarations []declaration
+}
+
+// selector is compound selectors joined by combinators, matched right to
+// left against an element and its ancestors.
+type selector []compoundSelector
+
+type compoundSelector struct {
+	element string // Empty for any element.
+	id      string
+	classes []string
+	child   bool // Whether it has to be the parent of the compound after it, rather than any ancestor.
+}
+
+// applyStyles works out the style of every node below root from its
+// presentation attributes, the <style> sheets of the document and its style
+// attribute.
+func applyStyles(root *node) {
+	var rules []cssRule
+	var collect func(n *node)
+	collect = func(n *node) {
+		if n.element == "style" {
+			if t := strings.TrimSpace(n.attrs["type"]); t == "" || t == "text/css" {
+				rules = append(rules, parseStyleSheet(n.text, len(rules))...)
+			}
+			return
+		}
+		for _, c := range n.children {
+			collect(c)
+		}
+	}
+	collect(root)
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		for k := range a.specificity {
+			if a.specificity[k] != b.specificity[k] {
+				return a.specificity[k] < b.specificity[k]
+			}
+		}
+		return a.order < b.order
+	})
+
+	var ancestors []*node
+	var apply func(n *node)
+	apply = func(n *node) {
+		if n.element == "" {
+			return
+		}
+		n.style = map[string]string{}
+		for name, v := range n.attrs {
+			if presentationProperties[name] {
+				n.style[name] = v
+			}
+		}
+		inline := parseDeclarations(n.attrs["style"])
+		// Important declarations beat normal ones, and for each the style
+		// attribute beats the sheets, which are in order of specificity.
+		for _, important := range []bool{false, true} {
+			for _, rule := range rules {
+				if rule.selector.matches(n, ancestors) {
+					n.style.set(rule.declarations, important)
+				}
+			}
+			n.style.set(inline, important)
+		}
+
+		ancestors = append(ancestors, n)
+		for _, c := range n.children {
+			apply(c)
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+	}
+	apply(root)
+}
+
+// style is the value of each property of an element once the cascade is
+// done.
+type style map[string]string
+
+// computeStyle returns specified, the style of an element, along with what
+// it inherits from parent, the computed style of the element it is in. The
+// inherit, initial and unset keywords are resolved, as are relative font
+// weights and sizes.
+func computeStyle(specified, parent style) style {
+	computed := style{}
+	for name, v := range parent {
+		if inheritedProperties[name] {
+			computed[name] = v
+		}
+	}
+	for name, v := range specified {
+		keyword := strings.ToLower(v)
+		if keyword == "unset" {
+			keyword = "initial"
+			if inheritedProperties[name] {
+				keyword = "inherit"
+			}
+		}
+		switch keyword {
+		case "inherit":
+			if inherited, ok := parent[name]; ok {
+				computed[name] = inherited
+			} else {
+				delete(computed, name)
+			}
+		case "initial":
+			if initial, ok := initialValues[name]; ok {
+				computed[name] = initial
+			} else {
+				delete(computed, name)
+			}
+		default:
+			computed[name] = v
+		}
+	}
+
+	// Bolder and lighter are relative to the weight of the parent, which a
+	// child inheriting them must not apply a second time.
+	if v, ok := specified["font-weight"]; ok && computed["font-weight"] == v {
+		inherited, err := parseFontWeight(parent["font-weight"], 400)
+		if err != nil {
+			inherited = 400
+		}
+		if weight, err := parseFontWeight(v, inherited); err == nil {
+			computed["font-weight"] = strconv.Itoa(weight)
+		}
+	}
+	// Relative font sizes work the same way.
+	if v, ok := specified["font-size"]; ok && computed["font-size"] == v {
+		inherited, err := parseFontSize(parent["font-size"], 16)
+		if err != nil {
+			inherited = 16
+		}
+		if size, err := parseFontSize(v, inherited); err == nil {
+			computed["font-size"] = strconv.FormatFloat(float64(size), 'g', -1, 32)
+		}
+	}
+	return computed
+}
+
+func (s style) set(declarations []declaration, important bool) {
+	for _, d := range declarations {
+		if d.important == important {
+			s[d.name] = d.value
+		}
+	}
+}
+
+// parseStyleSheet returns a rule for every selector of the rulesets in sheet.
+// As in a browser, what can't be parsed is skipped rather than reported.
+// order is that of the first rule.
+func parseStyleSheet(sheet string, order int) []cssRule {
+	sheet = stripComments(sheet)
+	var rules []cssRule
+	for {
+		sheet = strings.TrimLeft(sheet, " \t\r\n")
+		sheet = strings.TrimPrefix(strings.TrimPrefix(sheet, "<!--"), "-->")
+		sheet = strings.TrimLeft(sheet, " \t\r\n")
+		if sheet == "" {
+			return rules
+		}
+
+		open := strings.IndexByte(sheet, '{')
+		if strings.HasPrefix(sheet, "@") {
+			// At-rules such as @import end at a semicolon, the others
+			// with a block, neither of which apply here.
+			if semicolon := strings.IndexByte(sheet, ';'); semicolon >= 0 && (open < 0 || semicolon < open) {
+				sheet = sheet[semicolon+1:]
+				continue
+			}
+		}
+		if open < 0 {
+			return rules
+		}
+		end := blockEnd(sheet, open)
+		prelude, body := sheet[:open], sheet[open+1:end]
+		if end < len(sheet) {
+			end++
+		}
+		sheet = sheet[end:]
+		if strings.HasPrefix(prelude, "@") {
+			continue
+		}
+
+		declarations := parseDeclarations(body)
+		for _, text := range strings.Split(prelude, ",") {
+			sel, specificity, ok := parseSelector(text)
+			if !ok {
+				continue
+			}
+			rules = append(rules, cssRule{sel, specificity, order, declarations})
+			order++
+		}
+	}
+}
+
+func stripComments(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:start])
+		end := strings.Index(s[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		s = s[start+2+end+2:]
+	}
+}
+
+// blockEnd returns the index of the brace closing the block opened at open,
+// or the length of s if it isn't closed.
+func blockEnd(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// parseDeclarations parses a list such as "fill: red; stroke-width: 2
+// !important". Declarations without a name or a value are dropped.
+func parseDeclarations(s string) []declaration {
+	var declarations []declaration
+	for _, text := range splitOutside(s, ';') {
+		i := strings.IndexByte(text, ':')
+		if i < 0 {
+			continue
+		}
+		d := declaration{
+			name:  strings.ToLower(strings.TrimSpace(text[:i])),
+			value: strings.TrimSpace(text[i+1:]),
+		}
+		if bang := strings.LastIndexByte(d.value, '!'); bang >= 0 &&
+			strings.EqualFold(strings.TrimSpace(d.value[bang+1:]), "important") {
+			d.value, d.important = strings.TrimSpace(d.value[:bang]), true
+		}
+		if d.name == "" || d.value == "" {
+			continue
+		}
+		declarations = append(declarations, d)
+	}
+	return declarations
+}
+
+// splitOutside splits s at every sep that isn't quoted or in parentheses, so
+// that a url or a font name can hold one.
+func splitOutside(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseSelector parses a selector made of type, class, id and universal
+// selectors joined by descendant and child combinators. Anything else, like
+// a pseudo-class, isn't supported and the selector is dropped.
+func parseSelector(s string) (selector, [3]int, bool) {
+	var sel selector
+	var specificity [3]int
+	child := false
+	for _, part := range strings.Fields(strings.ReplaceAll(s, ">", " > ")) {
+		if part == ">" {
+			if len(sel) == 0 || child {
+				return nil, specificity, false
+			}
+			child = true
+			continue
+		}
+		if child {
+			sel[len(sel)-1].child = true
+			child = false
+		}
+
+		var compound compoundSelector
+		i := 0
+		name := func() string {
+			start := i
+			for i < len(part) && part[i] != '.' && part[i] != '#' {
+				i++
+			}
+			return part[start:i]
+		}
+		if part[0] != '.' && part[0] != '#' {
+			compound.element = name()
+			if compound.element == "*" {
+				compound.element = ""
+			} else {
+				specificity[2]++
+			}
+		}
+		for i < len(part) {
+			prefix := part[i]
+			i++
+			v := name()
+			if v == "" {
+				return nil, specificity, false
+			}
+			if prefix == '#' {
+				compound.id = v
+				specificity[0]++
+			} else {
+				compound.classes = append(compound.classes, v)
+				specificity[1]++
+			}
+		}
+		if !validSelectorName(compound.element) || !validSelectorName(compound.id) {
+			return nil, specificity, false
+		}
+		for _, class := range compound.classes {
+			if !validSelectorName(class) {
+				return nil, specificity, false
+			}
+		}
+		sel = append(sel, compound)
+	}
+	if len(sel) == 0 || child {
+		return nil, specificity, false
+	}
+	return sel, specificity, true
+}
+
+func validSelectorName(s string) bool {
+	for _, c := range s {
+		if !(c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c > 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether n, with ancestors from the root down to its
+// parent, is selected by s.
+func (s selector) matches(n *node, ancestors []*node) bool {
+	last := len(s) - 1
+	if !s[last].matches(n) {
+		return false
+	}
+	if last == 0 {
+		return true
+	}
+	rest := s[:last]
+	if rest[len(rest)-1].child {
+		return len(ancestors) > 0 && rest.matches(ancestors[len(ancestors)-1], ancestors[:len(ancestors)-1])
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if rest.matches(ancestors[i], ancestors[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compoundSelector) matches(n *node) bool {
+	if c.element != "" && c.element != n.element {
+		return false
+	}
+	if c.id != "" && c.id != n.attrs["id"] {
+		return false
+	}
+	classes := strings.Fields(n.attrs["class"])
+	for _, want := range c.classes {
+		found := false
+		for _, class := range classes {
+			if class == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
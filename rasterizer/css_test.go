@@ -0,0 +1,118 @@
+package rasterizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, test := range []struct {
+		in          string
+		want        selector
+		specificity [3]int
+	}{
+		{"rect", selector{{element: "rect"}}, [3]int{0, 0, 1}},
+		{"*", selector{{}}, [3]int{0, 0, 0}},
+		{".a", selector{{classes: []string{"a"}}}, [3]int{0, 1, 0}},
+		{"#b", selector{{id: "b"}}, [3]int{1, 0, 0}},
+		{"rect.a.c#b", selector{{element: "rect", id: "b", classes: []string{"a", "c"}}}, [3]int{1, 2, 1}},
+		{"g rect", selector{{element: "g"}, {element: "rect"}}, [3]int{0, 0, 2}},
+		{"g > .a", selector{{element: "g", child: true}, {classes: []string{"a"}}}, [3]int{0, 1, 1}},
+		{"g>.a", selector{{element: "g", child: true}, {classes: []string{"a"}}}, [3]int{0, 1, 1}},
+		{"  svg  g\n#x ", selector{{element: "svg"}, {element: "g"}, {id: "x"}}, [3]int{1, 0, 2}},
+	} {
+		got, specificity, ok := parseSelector(test.in)
+		if !ok {
+			t.Errorf("parseSelector(%q) wasn't supported", test.in)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) || specificity != test.specificity {
+			t.Errorf("parseSelector(%q) = %+v, %v, want %+v, %v", test.in, got, specificity, test.want, test.specificity)
+		}
+	}
+}
+
+func TestParseSelectorUnsupported(t *testing.T) {
+	for _, in := range []string{"", "a:hover", "[fill]", "a + b", "a ~ b", "> a", "a >", "a > > b", ".", "#", "a..b"} {
+		if got, _, ok := parseSelector(in); ok {
+			t.Errorf("parseSelector(%q) = %+v, want it dropped", in, got)
+		}
+	}
+}
+
+func TestParseDeclarations(t *testing.T) {
+	got := parseDeclarations(" Fill : red;stroke:blue !important;; :x; y: ;font-family: 'a;b'; opacity: 1 ! IMPORTANT ")
+	want := []declaration{
+		{name: "fill", value: "red"},
+		{name: "stroke", value: "blue", important: true},
+		{name: "font-family", value: "'a;b'"},
+		{name: "opacity", value: "1", important: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDeclarations = %+v, want %+v", got, want)
+	}
+}
+
+func TestCascade(t *testing.T) {
+	root, err := parseDocument([]byte(`<svg xmlns="http://www.w3.org/2000/svg">
+	<style>
+		/* Comments are skipped. */
+		rect { fill: red; stroke: red }
+		.a { fill: green }
+		#important { fill: yellow !important }
+		#id { fill: blue }
+		rect.b { stroke: green }
+		.b { stroke: blue }
+		g > .child { fill: orange }
+		svg .descendant { stroke: purple }
+		rect:hover, circle { fill: pink }
+		@media print { rect { fill: black } }
+	</style>
+	<style type="text/other">rect { fill: black }</style>
+	<rect id="type" fill="white"/>
+	<rect id="class" class="a" fill="white"/>
+	<rect id="id" class="a"/>
+	<rect id="specificity" class="a b"/>
+	<rect id="inline" class="a" style="fill: gray"/>
+	<rect id="important" style="fill: gray"/>
+	<rect id="inline-important" class="a" style="fill: gray !important"/>
+	<g><rect id="child" class="child descendant"/></g>
+	<g><a><rect id="grandchild" class="child descendant"/></a></g>
+	<circle id="circle"/>
+</svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]*node{}
+	var index func(n *node)
+	index = func(n *node) {
+		if id := n.attrs["id"]; id != "" {
+			ids[id] = n
+		}
+		for _, c := range n.children {
+			index(c)
+		}
+	}
+	index(root)
+
+	for _, test := range []struct {
+		id, property, want string
+	}{
+		{"type", "fill", "red"},              // Sheets beat presentation attributes.
+		{"class", "fill", "green"},           // Classes beat types.
+		{"id", "fill", "blue"},               // Ids beat classes.
+		{"specificity", "stroke", "green"},   // rect.b beats the later .b.
+		{"inline", "fill", "gray"},           // The style attribute beats sheets.
+		{"important", "fill", "yellow"},      // Important sheets beat the style attribute.
+		{"inline-important", "fill", "gray"}, // Important style attributes beat everything.
+		{"child", "fill", "orange"},          // Child combinator.
+		{"grandchild", "fill", "red"},        // Not a child of the g.
+		{"grandchild", "stroke", "purple"},   // Descendant combinator.
+		{"circle", "fill", "pink"},           // The supported selector of a list.
+	} {
+		n := ids[test.id]
+		if got := n.style[test.property]; got != test.want {
+			t.Errorf("%s of #%s = %q, want %q", test.property, test.id, got, test.want)
+		}
+	}
+}
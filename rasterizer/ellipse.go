@@ -0,0 +1,172 @@
+package rasterizer
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+type Circle struct {
+	transformable
+	Cx            float32
+	Cy            float32
+	R             float32
+	Fill          string
+	Stroke        string
+	FillOpacity   float32
+	StrokeOpacity float32
+	conic
+}
+
+// NewCircle returns an unstroked black circle centered on (cx, cy).
+func NewCircle(cx, cy, r float32) *Circle {
+	return &Circle{Cx: cx, Cy: cy, R: r, FillOpacity: 1, StrokeOpacity: 1}
+}
+
+func (s *Circle) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+	s.conic.compile(s.transformMatrix, s.Cx, s.Cy, s.R, s.R)
+	return nil
+}
+
+func (s *Circle) rasterize(r *Rasterizer) error {
+	return s.paint(r, s.source, s.transformMatrix, s.Fill, s.Stroke, s.FillOpacity, s.StrokeOpacity)
+}
+
+type Ellipse struct {
+	transformable
+	Cx            float32
+	Cy            float32
+	Rx            float32
+	Ry            float32
+	Fill          string
+	Stroke        string
+	FillOpacity   float32
+	StrokeOpacity float32
+	conic
+}
+
+// NewEllipse returns an unstroked black ellipse centered on (cx, cy).
+func NewEllipse(cx, cy, rx, ry float32) *Ellipse {
+	return &Ellipse{Cx: cx, Cy: cy, Rx: rx, Ry: ry, FillOpacity: 1, StrokeOpacity: 1}
+}
+
+func (s *Ellipse) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+	s.conic.compile(s.transformMatrix, s.Cx, s.Cy, s.Rx, s.Ry)
+	return nil
+}
+
+func (s *Ellipse) rasterize(r *Rasterizer) error {
+	return s.paint(r, s.source, s.transformMatrix, s.Fill, s.Stroke, s.FillOpacity, s.StrokeOpacity)
+}
+
+// conic is an axis aligned ellipse in user space which becomes any ellipse
+// once transformed. Samples are filled by mapping them back into user space
+// and testing them against the untransformed ellipse.
+type conic struct {
+	cx, cy, rx, ry float32
+	inverse        mgl.Mat3   // Maps the coordinate space of the document to user space.
+	bounds         [4]float32 // Min x, min y, max x and max y in the coordinate space of the document.
+	outline        []contour  // Flattened for stroking in the coordinate space of the document.
+	visible        bool
+}
+
+func (e *conic) compile(m mgl.Mat3, cx, cy, rx, ry float32) {
+	e.cx, e.cy, e.rx, e.ry = cx, cy, rx, ry
+	e.visible = rx > 0 && ry > 0 && m.Det() != 0
+	if !e.visible {
+		return
+	}
+	e.inverse = m.Inv()
+
+	corners := transformPoints([]float32{
+		cx - rx, cy - ry, cx + rx, cy - ry,
+		cx + rx, cy + ry, cx - rx, cy + ry,
+	}, m)
+	e.bounds = [4]float32{corners[0], corners[1], corners[0], corners[1]}
+	for i := 2; i < len(corners); i += 2 {
+		x, y := corners[i], corners[i+1]
+		if x < e.bounds[0] {
+			e.bounds[0] = x
+		}
+		if y < e.bounds[1] {
+			e.bounds[1] = y
+		}
+		if x > e.bounds[2] {
+			e.bounds[2] = x
+		}
+		if y > e.bounds[3] {
+			e.bounds[3] = y
+		}
+	}
+
+	// Two half arcs make up the outline.
+	e.outline = flattenPath([]pathCommand{
+		{op: 'M', args: [7]float32{cx + rx, cy}},
+		{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, cx - rx, cy}},
+		{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, cx + rx, cy}},
+		{op: 'Z'},
+	}, userTolerance(m))
+	for _, c := range e.outline {
+		transformPoints(c.points, m)
+	}
+}
+
+// paint fills and strokes the conic, which has the transform m, reporting bad
+// colors against the element at src.
+func (e *conic) paint(r *Rasterizer, src source, m mgl.Mat3, fill, stroke string, fillOpacity, strokeOpacity float32) error {
+	if !e.visible {
+		return nil
+	}
+
+	fillCol, ok, err := r.paint(fill, "black", fillOpacity, m, e.outline)
+	if err != nil {
+		return src.errorf("fill", err)
+	}
+	if ok {
+		e.fill(r, fillCol)
+	}
+
+	strokeCol, ok, err := r.paint(stroke, "none", strokeOpacity, m, e.outline)
+	if err != nil {
+		return src.errorf("stroke", err)
+	}
+	if ok {
+		r.strokeContours(e.outline, strokeCol)
+	}
+	return nil
+}
+
+func (e *conic) fill(r *Rasterizer, p pattern) {
+	sx, sy, ok := r.sampleScale()
+	if !ok {
+		return
+	}
+	xStart, xEnd := sampleSpan(math.Ceil(float64(e.bounds[0]*sx)), math.Floor(float64(e.bounds[2]*sx))+1, r.widthPixels)
+	yStart, yEnd := sampleSpan(math.Ceil(float64(e.bounds[1]*sy)), math.Floor(float64(e.bounds[3]*sy))+1, r.heightPixels)
+
+	m := e.inverse
+	for y := yStart; y < yEnd; y++ {
+		docY := float32(y) / sy
+		for x := xStart; x < xEnd; x++ {
+			docX := float32(x) / sx
+			ux := m[0]*docX + m[3]*docY + m[6]
+			uy := m[1]*docX + m[4]*docY + m[7]
+			dx, dy := (ux-e.cx)/e.rx, (uy-e.cy)/e.ry
+			if dx*dx+dy*dy <= 1 {
+				r.blendSample(x, y, p.at(docX, docY))
+			}
+		}
+	}
+}
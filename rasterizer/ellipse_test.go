@@ -0,0 +1,32 @@
+package rasterizer
+
+import "testing"
+
+func TestEllipseRadii(t *testing.T) {
+	for _, test := range []struct {
+		attrs  string
+		rx, ry float32
+	}{
+		{`rx="3" ry="2"`, 3, 2},
+		{`rx="3"`, 3, 3},
+		{`ry="2"`, 2, 2},
+		{`rx="auto" ry="2"`, 2, 2},
+		{`rx="3" ry=" auto "`, 3, 3},
+		{`rx="auto" ry="auto"`, 0, 0},
+		{``, 0, 0},
+	} {
+		root, err := parseDocument([]byte(`<svg width="10" height="10"><ellipse ` + test.attrs + `/></svg>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		svg, err := newDocument(root)
+		if err != nil {
+			t.Errorf("%s: %v", test.attrs, err)
+			continue
+		}
+		e := svg.children[0].(*Ellipse)
+		if e.Rx != test.rx || e.Ry != test.ry {
+			t.Errorf("%s: radii = %v, %v, want %v, %v", test.attrs, e.Rx, e.Ry, test.rx, test.ry)
+		}
+	}
+}
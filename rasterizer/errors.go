@@ -0,0 +1,37 @@
+package rasterizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError reports input in a document that could not be understood.
+// Line and Column are 1 based and point at the start of the offending
+// element, or are 0 for an element built in Go which has no place in a
+// document. Attr is empty when the problem is not tied to a single attribute.
+type ParseError struct {
+	Element string
+	Attr    string
+	Line    int
+	Column  int
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	var parts []string
+	if e.Line > 0 {
+		parts = append(parts, fmt.Sprintf("line %d, column %d", e.Line, e.Column))
+	}
+	what := e.Attr
+	if e.Element != "" {
+		what = strings.TrimSpace("<" + e.Element + "> " + e.Attr)
+	}
+	if what != "" {
+		parts = append(parts, what)
+	}
+	return strings.Join(append(parts, e.Err.Error()), ": ")
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,66 @@
+package rasterizer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, test := range []struct {
+		doc  string
+		want ParseError
+	}{
+		{"<svg width=\"1\" height=\"1\">\n<rect></svg>",
+			ParseError{Line: 2, Column: 13}},
+		{`<notsvg/>`,
+			ParseError{Element: "notsvg", Line: 1, Column: 1}},
+		{`<svg width="-1" height="10"/>`,
+			ParseError{Element: "svg", Attr: "width", Line: 1, Column: 1}},
+		{`<svg width="10" height="10">
+  <rect width="x"/>
+</svg>`, ParseError{Element: "rect", Attr: "width", Line: 2, Column: 3}},
+		{`<svg width="10" height="10">
+	<g>
+		<circle r="1" fill="bluish"/>
+	</g>
+</svg>`, ParseError{Element: "circle", Attr: "fill", Line: 3, Column: 3}},
+		{`<svg width="10" height="10"><path d="M 0 0 L 1"/></svg>`,
+			ParseError{Element: "path", Attr: "d", Line: 1, Column: 29}},
+		{`<svg width="10" height="10"><polygon points="0,0 1"/></svg>`,
+			ParseError{Element: "polygon", Attr: "points", Line: 1, Column: 29}},
+		{`<svg width="10" height="10"><g transform="skew(1)"/></svg>`,
+			ParseError{Element: "g", Attr: "transform", Line: 1, Column: 29}},
+	} {
+		err := New().SetSvg([]byte(test.doc))
+		var got *ParseError
+		if !errors.As(err, &got) {
+			t.Errorf("%s: error = %v, want a *ParseError", test.doc, err)
+			continue
+		}
+		if got.Element != test.want.Element || got.Attr != test.want.Attr ||
+			got.Line != test.want.Line || got.Column != test.want.Column {
+			t.Errorf("%s: error at <%s> %s, line %d, column %d, want <%s> %s, line %d, column %d", test.doc,
+				got.Element, got.Attr, got.Line, got.Column,
+				test.want.Element, test.want.Attr, test.want.Line, test.want.Column)
+		}
+		if got.Err == nil {
+			t.Errorf("%s: error has no cause", test.doc)
+		}
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	for _, test := range []struct {
+		err  ParseError
+		want string
+	}{
+		{ParseError{Element: "rect", Attr: "fill", Line: 2, Column: 3, Err: errors.New("bad")}, "line 2, column 3: <rect> fill: bad"},
+		{ParseError{Element: "svg", Line: 1, Column: 1, Err: errors.New("bad")}, "line 1, column 1: <svg>: bad"},
+		{ParseError{Attr: "fill", Err: errors.New("bad")}, "fill: bad"},
+		{ParseError{Err: errors.New("bad")}, "bad"},
+	} {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package rasterizer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// fontFace is a font along with what text is matched against to pick it.
+type fontFace struct {
+	family string // Lower case.
+	weight int    // 100 to 900.
+	italic bool
+	font   *sfnt.Font
+}
+
+func newFontFace(data []byte) (*fontFace, error) {
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf sfnt.Buffer
+	family, err := f.Name(&buf, sfnt.NameIDTypographicFamily)
+	if err != nil {
+		if family, err = f.Name(&buf, sfnt.NameIDFamily); err != nil {
+			return nil, err
+		}
+	}
+	subfamily, _ := f.Name(&buf, sfnt.NameIDSubfamily)
+	subfamily = strings.ToLower(subfamily)
+
+	face := &fontFace{
+		family: strings.ToLower(family),
+		weight: weightClass(data),
+		italic: strings.Contains(subfamily, "italic") || strings.Contains(subfamily, "oblique"),
+		font:   f,
+	}
+	if face.weight == 0 {
+		face.weight = 400
+		if strings.Contains(subfamily, "bold") {
+			face.weight = 700
+		}
+	}
+	return face, nil
+}
+
+// weightClass reads the weight of a font from its OS/2 table, which sfnt
+// doesn't expose, or returns 0 if it has none.
+func weightClass(data []byte) int {
+	if len(data) < 12 {
+		return 0
+	}
+	tables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < tables; i++ {
+		if 12+16*(i+1) > len(data) {
+			return 0
+		}
+		record := data[12+16*i:]
+		if string(record[:4]) != "OS/2" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		if offset+6 > len(data) {
+			return 0
+		}
+		weight := int(binary.BigEndian.Uint16(data[offset+4:]))
+		if weight < 1 || weight > 1000 {
+			return 0
+		}
+		return weight
+	}
+	return 0
+}
+
+var (
+	bundledOnce  sync.Once
+	bundledFaces []*fontFace
+)
+
+// bundledFonts are the Go fonts, which text falls back on so that it can be
+// drawn without any fonts installed.
+func bundledFonts() []*fontFace {
+	bundledOnce.Do(func() {
+		for _, data := range [][]byte{goregular.TTF, gobold.TTF, gomono.TTF, gomonobold.TTF} {
+			face, err := newFontFace(data)
+			if err != nil {
+				panic(err)
+			}
+			bundledFaces = append(bundledFaces, face)
+		}
+	})
+	return bundledFaces
+}
+
+// genericFamilies maps the generic font families onto the bundled fonts.
+var genericFamilies = map[string]string{
+	"serif":      "go",
+	"sans-serif": "go",
+	"system-ui":  "go",
+	"cursive":    "go",
+	"fantasy":    "go",
+	"monospace":  "go mono",
+}
+
+// LoadFonts makes the TrueType and OpenType fonts in dir and the directories
+// below it available to the text of documents set afterwards. Text that none
+// of them match is drawn with a bundled Go font.
+func (r *Rasterizer) LoadFonts(dir string) error {
+	fsys := os.DirFS(dir)
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".ttf", ".otf":
+		default:
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		face, err := newFontFace(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path.Join(dir, name), err)
+		}
+		r.fonts = append(r.fonts, face)
+		return nil
+	})
+}
+
+// matchFont picks the face for a font-family list such as
+// "'Open Sans', Arial, sans-serif" from loaded, falling back on the bundled
+// fonts. Of the faces of a family the upright one closest to weight wins.
+func matchFont(loaded []*fontFace, families string, weight int) *fontFace {
+	for _, family := range strings.Split(families, ",") {
+		family = strings.ToLower(strings.Trim(strings.TrimSpace(family), `"'`))
+		faces := loaded
+		if generic, ok := genericFamilies[family]; ok {
+			family, faces = generic, bundledFonts()
+		}
+		if face := closestFace(faces, family, weight); face != nil {
+			return face
+		}
+		if face := closestFace(bundledFonts(), family, weight); face != nil {
+			return face
+		}
+	}
+	return closestFace(bundledFonts(), "go", weight)
+}
+
+func closestFace(faces []*fontFace, family string, weight int) *fontFace {
+	var best *fontFace
+	bestDistance := 0
+	for _, face := range faces {
+		if face.family != family {
+			continue
+		}
+		distance := face.weight - weight
+		if distance < 0 {
+			distance = -distance
+		}
+		if face.italic {
+			distance += 1000
+		}
+		if best == nil || distance < bestDistance {
+			best, bestDistance = face, distance
+		}
+	}
+	return best
+}
+
+// parseFontWeight turns a font-weight into a number from 1 to 1000. Bolder
+// and lighter are relative to inherited.
+func parseFontWeight(v string, inherited int) (int, error) {
+	switch strings.TrimSpace(v) {
+	case "", "inherit":
+		return inherited, nil
+	case "normal":
+		return 400, nil
+	case "bold":
+		return 700, nil
+	case "bolder":
+		switch {
+		case inherited < 350:
+			return 400, nil
+		case inherited < 550:
+			return 700, nil
+		}
+		return 900, nil
+	case "lighter":
+		switch {
+		case inherited < 550:
+			return 100, nil
+		case inherited < 750:
+			return 400, nil
+		}
+		return 700, nil
+	}
+	weight, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || weight < 1 || weight > 1000 {
+		return 0, fmt.Errorf("invalid font weight %q", v)
+	}
+	return weight, nil
+}
+
+// fontSizes are the sizes of the absolute font-size keywords.
+var fontSizes = map[string]float32{
+	"xx-small":  9,
+	"x-small":   10,
+	"small":     13,
+	"medium":    16,
+	"large":     18,
+	"x-large":   24,
+	"xx-large":  32,
+	"xxx-large": 48,
+}
+
+// parseFontSize turns a font-size into user units. Percentages, em and ex are
+// relative to inherited, with an ex taken to be half an em, and so are the
+// keywords smaller and larger.
+func parseFontSize(v string, inherited float32) (float32, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "", "inherit":
+		return inherited, nil
+	case "smaller":
+		return inherited / 1.2, nil
+	case "larger":
+		return inherited * 1.2, nil
+	}
+	if size, ok := fontSizes[v]; ok {
+		return size, nil
+	}
+	f, unit, err := splitLength(v)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "%":
+		return f / 100 * inherited, nil
+	case "em":
+		return f * inherited, nil
+	case "ex":
+		return f * inherited / 2, nil
+	}
+	size, ok := lengthUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", unit)
+	}
+	return f * size, nil
+}
@@ -0,0 +1,65 @@
+package rasterizer
+
+import (
+	"testing"
+)
+
+func TestParseFontSize(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want float32
+	}{
+		{"", 20},
+		{"inherit", 20},
+		{"12", 12},
+		{"12px", 12},
+		{"9pt", 12},
+		{"50%", 10},
+		{"2em", 40},
+		{"1ex", 10},
+		{"medium", 16},
+		{" X-Large ", 24},
+		{"smaller", 20 / 1.2},
+		{"larger", 24},
+		{"0", 0},
+	} {
+		got, err := parseFontSize(test.in, 20)
+		if err != nil {
+			t.Errorf("parseFontSize(%q) returned error %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseFontSize(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+	for _, in := range []string{"big", "12q", "em"} {
+		if got, err := parseFontSize(in, 20); err == nil {
+			t.Errorf("parseFontSize(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestTextFontSize(t *testing.T) {
+	for _, test := range []struct {
+		doc   string
+		drawn bool
+	}{
+		{`<text y="9" font-size="large"><tspan font-size="smaller">M</tspan></text>`, true},
+		{`<text y="9" font-size="xx-small">M</text>`, true},
+		{`<text y="9" font-size="10"><tspan font-size="0">MMM</tspan></text>`, false},
+		{`<text y="9" font-size="0">M<tspan font-size="10">M</tspan></text>`, true},
+	} {
+		img, err := drawSvg(t, test.doc)
+		if err != nil {
+			t.Errorf("%s: %v", test.doc, err)
+			continue
+		}
+		drawn := false
+		for i := 0; i < len(img.Pix); i++ {
+			drawn = drawn || img.Pix[i] != 255
+		}
+		if drawn != test.drawn {
+			t.Errorf("%s: drawn = %v, want %v", test.doc, drawn, test.drawn)
+		}
+	}
+}
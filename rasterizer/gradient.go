@@ -0,0 +1,384 @@
+package rasterizer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// pattern is what a shape is painted with, giving the color of every sample.
+type pattern interface {
+	// at returns the color at a point in the coordinate space of the
+	// document.
+	at(x, y float32) Color
+}
+
+// A Color paints every sample the same.
+func (c Color) at(x, y float32) Color {
+	return c
+}
+
+// PaintServer is a gradient that fill and stroke refer to with url(#id) once
+// it is added to the document with Define.
+type PaintServer interface {
+	// pattern returns what a shape with the transform m and the bounding box
+	// bbox, in user space, is painted with. ok is false if nothing is
+	// painted.
+	pattern(m mgl.Mat3, bbox [4]float32, opacity float32) (p pattern, ok bool)
+}
+
+// Define makes p what the fill and stroke of the elements of the document
+// refer to as url(#id).
+func (s *Svg) Define(id string, p PaintServer) {
+	if s.paintServers == nil {
+		s.paintServers = map[string]PaintServer{}
+	}
+	s.paintServers[id] = p
+}
+
+// GradientStop is a color at Offset along a gradient, from 0 to 1. Like the
+// opacities of shapes, Opacity is 0 in the zero value, which makes the stop
+// transparent, so stops are best made with NewGradientStop.
+type GradientStop struct {
+	Offset  float32
+	Color   string
+	Opacity float32 // 1 for opaque.
+}
+
+// NewGradientStop returns an opaque stop of col at offset.
+func NewGradientStop(offset float32, col string) GradientStop {
+	return GradientStop{Offset: offset, Color: col, Opacity: 1}
+}
+
+// Gradient holds what linear and radial gradients share.
+type Gradient struct {
+	Stops []GradientStop
+	// UserSpace places the gradient in the user space of the shape painted
+	// with it, rather than in its bounding box where 0 and 1 are its edges.
+	UserSpace bool
+	Transform mgl.Mat3 // The zero matrix stands for the identity.
+	Spread    string   // pad, reflect or repeat past the ends of the gradient.
+}
+
+// space returns the matrix from the coordinate space of the gradient to that
+// of the document, or false if the bounding box it needs is empty.
+func (g *Gradient) space(m mgl.Mat3, bbox [4]float32) (mgl.Mat3, bool) {
+	if !g.UserSpace {
+		w, h := bbox[2]-bbox[0], bbox[3]-bbox[1]
+		if w <= 0 || h <= 0 {
+			return mgl.Mat3{}, false
+		}
+		m = m.Mul3(affine(w, 0, 0, h, bbox[0], bbox[1]))
+	}
+	if g.Transform != (mgl.Mat3{}) {
+		m = m.Mul3(g.Transform)
+	}
+	return m, m.Det() != 0
+}
+
+// gradientStop is a stop with its color worked out and premultiplied.
+type gradientStop struct {
+	offset float32
+	color  Color
+}
+
+// ramp is the colors of a gradient from 0 to 1.
+type ramp struct {
+	stops  []gradientStop
+	spread string
+}
+
+// newRamp returns the colors of stops, which is false if there are none. An
+// invalid color paints nothing.
+func newRamp(g *Gradient, opacity float32) (ramp, bool) {
+	if len(g.Stops) == 0 {
+		return ramp{}, false
+	}
+	rp := ramp{spread: g.Spread}
+	previous := float32(0)
+	for _, s := range g.Stops {
+		col, ok, err := parseColor(s.Color)
+		if err != nil {
+			return ramp{}, false
+		}
+		if !ok {
+			col = Color{}
+		}
+		col.a *= s.Opacity * opacity
+		col.r, col.g, col.b = col.r*col.a, col.g*col.a, col.b*col.a
+
+		// Offsets never go backwards.
+		offset := float32(math.Min(math.Max(float64(s.Offset), float64(previous)), 1))
+		previous = offset
+		rp.stops = append(rp.stops, gradientStop{offset, col})
+	}
+	return rp, true
+}
+
+// last is the color a gradient with no length paints with.
+func (rp ramp) last() Color {
+	return unpremultiply(rp.stops[len(rp.stops)-1].color)
+}
+
+// color returns the color at t, which is spread past 0 and 1.
+func (rp ramp) color(t float32) Color {
+	switch rp.spread {
+	case "repeat":
+		t -= float32(math.Floor(float64(t)))
+	case "reflect":
+		t = float32(math.Mod(math.Abs(float64(t)), 2))
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+
+	stops := rp.stops
+	if t <= stops[0].offset {
+		return unpremultiply(stops[0].color)
+	}
+	for i := 1; i < len(stops); i++ {
+		if t >= stops[i].offset {
+			continue
+		}
+		a, b := stops[i-1], stops[i]
+		amount := (t - a.offset) / (b.offset - a.offset)
+		return unpremultiply(blendColor(b.color, a.color, amount))
+	}
+	return rp.last()
+}
+
+func unpremultiply(c Color) Color {
+	if c.a == 0 {
+		return Color{}
+	}
+	return Color{c.r / c.a, c.g / c.a, c.b / c.a, c.a}
+}
+
+// LinearGradient is a <linearGradient>, which changes color along the line
+// from (X1, Y1) to (X2, Y2).
+type LinearGradient struct {
+	Gradient
+	X1, Y1, X2, Y2 float32
+}
+
+// NewLinearGradient returns a gradient from left to right across the
+// bounding box of what it paints.
+func NewLinearGradient(stops ...GradientStop) *LinearGradient {
+	return &LinearGradient{Gradient: Gradient{Stops: stops}, X2: 1}
+}
+
+func (g *LinearGradient) pattern(m mgl.Mat3, bbox [4]float32, opacity float32) (pattern, bool) {
+	rp, ok := newRamp(&g.Gradient, opacity)
+	if !ok {
+		return nil, false
+	}
+	space, ok := g.space(m, bbox)
+	if !ok {
+		return nil, false
+	}
+	dx, dy := g.X2-g.X1, g.Y2-g.Y1
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return rp.last(), true
+	}
+	return &linearPattern{
+		ramp: rp, inverse: space.Inv(),
+		x1: g.X1, y1: g.Y1, dx: dx / length, dy: dy / length,
+	}, true
+}
+
+type linearPattern struct {
+	ramp
+	inverse mgl.Mat3 // Maps the coordinate space of the document to that of the gradient.
+	x1, y1  float32
+	dx, dy  float32 // The vector along the gradient divided by its length squared.
+}
+
+func (p *linearPattern) at(x, y float32) Color {
+	m := p.inverse
+	gx := m[0]*x + m[3]*y + m[6]
+	gy := m[1]*x + m[4]*y + m[7]
+	return p.color((gx-p.x1)*p.dx + (gy-p.y1)*p.dy)
+}
+
+// RadialGradient is a <radialGradient>, which changes color from the focal
+// circle at (Fx, Fy) with radius Fr out to the circle at (Cx, Cy) with
+// radius R.
+type RadialGradient struct {
+	Gradient
+	Cx, Cy, R  float32
+	Fx, Fy, Fr float32
+}
+
+// NewRadialGradient returns a gradient from the center of the bounding box
+// of what it paints out to its edges.
+func NewRadialGradient(stops ...GradientStop) *RadialGradient {
+	return &RadialGradient{Gradient: Gradient{Stops: stops},
+		Cx: 0.5, Cy: 0.5, R: 0.5, Fx: 0.5, Fy: 0.5}
+}
+
+func (g *RadialGradient) pattern(m mgl.Mat3, bbox [4]float32, opacity float32) (pattern, bool) {
+	rp, ok := newRamp(&g.Gradient, opacity)
+	if !ok {
+		return nil, false
+	}
+	space, ok := g.space(m, bbox)
+	if !ok {
+		return nil, false
+	}
+	if g.R <= 0 {
+		return rp.last(), true
+	}
+	p := &radialPattern{
+		ramp: rp, inverse: space.Inv(),
+		fx: float64(g.Fx), fy: float64(g.Fy), fr: float64(g.Fr),
+		dx: float64(g.Cx - g.Fx), dy: float64(g.Cy - g.Fy), dr: float64(g.R - g.Fr),
+	}
+	p.a = p.dx*p.dx + p.dy*p.dy - p.dr*p.dr
+	return p, true
+}
+
+// radialPattern finds the circle between the focal circle and the end circle
+// that a point lies on, with t going from 0 on the focal circle to 1 on the
+// end circle. Where circles overlap the one with the largest t wins, and
+// points no circle passes through are left transparent.
+type radialPattern struct {
+	ramp
+	inverse    mgl.Mat3 // Maps the coordinate space of the document to that of the gradient.
+	fx, fy, fr float64
+	dx, dy, dr float64 // From the focal circle to the end circle.
+	a          float64 // The squared term of the equation solved for t.
+}
+
+func (p *radialPattern) at(x, y float32) Color {
+	m := p.inverse
+	px := float64(m[0]*x+m[3]*y+m[6]) - p.fx
+	py := float64(m[1]*x+m[4]*y+m[7]) - p.fy
+
+	// The point is on the circle at t when
+	// |p - t*d| = fr + t*dr, or a*t^2 - 2*b*t + c = 0.
+	b := px*p.dx + py*p.dy + p.fr*p.dr
+	c := px*px + py*py - p.fr*p.fr
+	var t float64
+	if p.a == 0 {
+		if b == 0 {
+			return Color{}
+		}
+		t = c / (2 * b)
+	} else {
+		discriminant := b*b - p.a*c
+		if discriminant < 0 {
+			return Color{}
+		}
+		root := math.Sqrt(discriminant)
+		t0, t1 := (b-root)/p.a, (b+root)/p.a
+		t = math.Max(t0, t1)
+		if p.fr+t*p.dr < 0 {
+			t = math.Min(t0, t1)
+		}
+	}
+	// Circles don't have a negative radius.
+	if p.fr+t*p.dr < 0 {
+		return Color{}
+	}
+	return p.color(float32(t))
+}
+
+// paint returns what to paint with for v, a fill or stroke given as a color
+// or as url(#id) with an optional color to fall back on. An empty v stands
+// for missing. m is the transform of the shape being painted and outline its
+// geometry in the coordinate space of the document, which a gradient is
+// fit to.
+func (r *Rasterizer) paint(v, missing string, opacity float32, m mgl.Mat3, outline []contour) (pattern, bool, error) {
+	if v == "" {
+		v = missing
+	}
+	if !strings.HasPrefix(v, "url(") {
+		col, ok, err := parseColor(v)
+		col.a *= opacity
+		return col, ok, err
+	}
+
+	id, fallback, err := parsePaintURL(v)
+	if err != nil {
+		return nil, false, err
+	}
+	server := r.paintServers[id]
+	if server == nil {
+		// Without a fallback a missing paint server paints nothing.
+		if fallback == "" {
+			fallback = "none"
+		}
+		col, ok, err := parseColor(fallback)
+		col.a *= opacity
+		return col, ok, err
+	}
+	p, ok := server.pattern(m, userBounds(outline, m), opacity)
+	return p, ok, nil
+}
+
+// checkPaint reports a fill or stroke that paint would fail on, so that
+// scenes built in Go are rejected when they are set rather than drawn.
+func (s source) checkPaint(attr, v string) error {
+	var err error
+	if strings.HasPrefix(v, "url(") {
+		var fallback string
+		if _, fallback, err = parsePaintURL(v); err == nil && fallback != "" {
+			_, _, err = parseColor(fallback)
+		}
+	} else if v != "" {
+		_, _, err = parseColor(v)
+	}
+	if err != nil {
+		return s.errorf(attr, err)
+	}
+	return nil
+}
+
+// checkPaints is checkPaint for both the fill and the stroke of a shape.
+func (s source) checkPaints(fill, stroke string) error {
+	if err := s.checkPaint("fill", fill); err != nil {
+		return err
+	}
+	return s.checkPaint("stroke", stroke)
+}
+
+// parsePaintURL splits a paint such as "url(#shine) red" into the id it
+// references and the color after it.
+func parsePaintURL(v string) (id, fallback string, err error) {
+	end := strings.IndexByte(v, ')')
+	if end < 0 {
+		return "", "", fmt.Errorf("invalid paint %q", v)
+	}
+	if id, err = parseURL(v[:end+1]); err != nil {
+		return "", "", err
+	}
+	return id, strings.TrimSpace(v[end+1:]), nil
+}
+
+// userBounds returns the min x, min y, max x and max y of outline, which is in
+// the coordinate space of the document, in the user space m maps from.
+func userBounds(outline []contour, m mgl.Mat3) [4]float32 {
+	if m.Det() == 0 {
+		return [4]float32{}
+	}
+	inverse := m.Inv()
+	bounds := [4]float32{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.Inf(-1))}
+	for _, c := range outline {
+		for i := 0; i+1 < len(c.points); i += 2 {
+			x, y := c.points[i], c.points[i+1]
+			ux := inverse[0]*x + inverse[3]*y + inverse[6]
+			uy := inverse[1]*x + inverse[4]*y + inverse[7]
+			bounds[0] = float32(math.Min(float64(bounds[0]), float64(ux)))
+			bounds[1] = float32(math.Min(float64(bounds[1]), float64(uy)))
+			bounds[2] = float32(math.Max(float64(bounds[2]), float64(ux)))
+			bounds[3] = float32(math.Max(float64(bounds[3]), float64(uy)))
+		}
+	}
+	if bounds[0] > bounds[2] {
+		return [4]float32{}
+	}
+	return bounds
+}
@@ -0,0 +1,23 @@
+package rasterizer
+
+import "testing"
+
+func TestGradientFromGo(t *testing.T) {
+	doc := NewDocument(10, 10)
+	doc.Define("g", NewLinearGradient(NewGradientStop(0, "red"), NewGradientStop(1, "red")))
+	rect := NewRect(0, 0, 10, 10)
+	rect.Fill = "url(#g)"
+	doc.Add(rect)
+
+	r := New()
+	if err := r.SetScene(doc); err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.Draw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.RGBAAt(5, 5); got != red {
+		t.Errorf("pixel (5, 5) = %v, want %v", got, red)
+	}
+}
@@ -0,0 +1,271 @@
+package rasterizer
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// Image is an <image> element. PNG, JPEG, GIF, BMP and TIFF images are
+// decoded.
+type Image struct {
+	transformable
+	X      float32
+	Y      float32
+	Width  float32 // Zero along with Height for the size of the image.
+	Height float32 // Zero for the height that keeps the aspect ratio at Width.
+	// How the image is fit into its area, such as "xMidYMid meet" when
+	// empty.
+	PreserveAspectRatio string
+	Href                string      // A data url or a path relative to the document, nothing is drawn when empty.
+	img                 image.Image // Decoded from Href unless given to NewImage.
+	mipMaps             []mip
+	inverse             mgl.Mat3   // Maps the coordinate space of the document to pixels of the image.
+	area                [4]float32 // Part of the image inside its area, in pixels of the image.
+	bounds              [4]float32 // Min x, min y, max x and max y in the coordinate space of the document.
+	visible             bool
+}
+
+// NewImage returns an element drawing img fit into the given area.
+func NewImage(img image.Image, x, y, width, height float32) *Image {
+	return &Image{X: x, Y: y, Width: width, Height: height, img: img}
+}
+
+// mip is an image with premultiplied alpha, or one of its halvings.
+type mip struct {
+	w    int
+	h    int
+	data []byte
+}
+
+func (m *mip) At(x, y int) Color {
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	if x >= m.w {
+		x = m.w - 1
+	}
+	if y >= m.h {
+		y = m.h - 1
+	}
+
+	i := (x + y*m.w) * 4
+
+	return Color{float32(m.data[i]) / 0xFF,
+		float32(m.data[i+1]) / 0xFF,
+		float32(m.data[i+2]) / 0xFF,
+		float32(m.data[i+3]) / 0xFF}
+}
+
+// bilinear blends the four pixels around (x, y), which is in pixels of m with
+// pixel centers at halves.
+func (m *mip) bilinear(x, y float32) Color {
+	x -= 0.5
+	y -= 0.5
+	x0, y0 := float32(math.Floor(float64(x))), float32(math.Floor(float64(y)))
+	tx, ty := x-x0, y-y0
+
+	c00 := m.At(int(x0), int(y0))
+	c10 := m.At(int(x0)+1, int(y0))
+	c01 := m.At(int(x0), int(y0)+1)
+	c11 := m.At(int(x0)+1, int(y0)+1)
+
+	return blendColor(blendColor(c11, c01, tx), blendColor(c10, c00, tx), ty)
+}
+
+func blendColor(c0, c1 Color, amount float32) Color {
+	return Color{blend(c0.r, c1.r, amount), blend(c0.g, c1.g, amount),
+		blend(c0.b, c1.b, amount), blend(c0.a, c1.a, amount)}
+}
+
+func blend(x0, x1, amount float32) float32 {
+	return x0*amount + x1*(1-amount)
+}
+
+// generateMipMaps halves img, rounding odd sizes up, until it is a single
+// pixel.
+func generateMipMaps(img image.Image) []mip {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	mips := []mip{{w, h, rgba.Pix}}
+	for w > 1 || h > 1 {
+		mips = append(mips, halve(mips[len(mips)-1]))
+		w, h = mips[len(mips)-1].w, mips[len(mips)-1].h
+	}
+	return mips
+}
+
+// halve averages every two by two pixels of m. The last row or column of an
+// odd size is averaged with itself.
+func halve(m mip) mip {
+	w, h := (m.w+1)/2, (m.h+1)/2
+	target := mip{w, h, make([]byte, w*h*4)}
+	for y := 0; y < h; y++ {
+		y0, y1 := 2*y, 2*y+1
+		if y1 >= m.h {
+			y1 = m.h - 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := 2*x, 2*x+1
+			if x1 >= m.w {
+				x1 = m.w - 1
+			}
+			for c := 0; c < 4; c++ {
+				sum := int(m.data[(x0+y0*m.w)*4+c]) + int(m.data[(x1+y0*m.w)*4+c]) +
+					int(m.data[(x0+y1*m.w)*4+c]) + int(m.data[(x1+y1*m.w)*4+c])
+				target.data[(x+y*w)*4+c] = byte((sum + 2) / 4)
+			}
+		}
+	}
+	return target
+}
+
+func (s *Image) rasterize(r *Rasterizer) error {
+	if !s.visible {
+		return nil
+	}
+	sx, sy, ok := r.sampleScale()
+	if !ok {
+		return nil
+	}
+	m := s.inverse
+
+	// The level whose pixels are closest to the size of a sample.
+	footprint := math.Max(math.Hypot(float64(m[0]/sx), float64(m[1]/sx)),
+		math.Hypot(float64(m[3]/sy), float64(m[4]/sy)))
+	level := 0
+	if footprint > 1 {
+		level = int(math.Log2(footprint))
+	}
+	if level >= len(s.mipMaps) {
+		level = len(s.mipMaps) - 1
+	}
+	mip := &s.mipMaps[level]
+	scaleX := float32(mip.w) / float32(s.mipMaps[0].w)
+	scaleY := float32(mip.h) / float32(s.mipMaps[0].h)
+
+	xStart, xEnd := sampleSpan(math.Floor(float64(s.bounds[0]*sx)), math.Ceil(float64(s.bounds[2]*sx)), r.widthPixels)
+	yStart, yEnd := sampleSpan(math.Floor(float64(s.bounds[1]*sy)), math.Ceil(float64(s.bounds[3]*sy)), r.heightPixels)
+	// Pixels of the image are looked up at the center of each sample so
+	// that an image drawn at its own size isn't shifted half a pixel.
+	for y := yStart; y < yEnd; y++ {
+		docY := (float32(y) + 0.5) / sy
+		for x := xStart; x < xEnd; x++ {
+			docX := (float32(x) + 0.5) / sx
+			u := m[0]*docX + m[3]*docY + m[6]
+			v := m[1]*docX + m[4]*docY + m[7]
+			if u < s.area[0] || u >= s.area[2] || v < s.area[1] || v >= s.area[3] {
+				continue
+			}
+
+			col := mip.bilinear(u*scaleX, v*scaleY)
+			if col.a == 0 {
+				continue
+			}
+			col.r, col.g, col.b = col.r/col.a, col.g/col.a, col.b/col.a
+			r.blendSample(x, y, col)
+		}
+	}
+	return nil
+}
+
+// compile decodes the image, calculates its mip maps and fits it into its
+// area.
+func (s *Image) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if s.img == nil {
+		// An image that references nothing isn't drawn.
+		if s.visible = s.Href != ""; !s.visible {
+			return nil
+		}
+		if err := s.load(c); err != nil {
+			return err
+		}
+	}
+	s.mipMaps = generateMipMaps(s.img)
+
+	imgW, imgH := float32(s.mipMaps[0].w), float32(s.mipMaps[0].h)
+	w, h := s.Width, s.Height
+	switch {
+	case w == 0 && h == 0:
+		w, h = imgW, imgH
+	case h == 0 && imgW > 0:
+		h = w * imgH / imgW
+	case w == 0 && imgH > 0:
+		w = h * imgW / imgH
+	}
+	s.visible = w > 0 && h > 0 && imgW > 0 && imgH > 0
+	if !s.visible {
+		return nil
+	}
+
+	fit, err := viewBoxTransform([]float32{0, 0, imgW, imgH}, w, h, s.PreserveAspectRatio)
+	if err != nil {
+		return s.errorf("preserveAspectRatio", err)
+	}
+	m := s.transformMatrix.Mul3(mgl.Translate2D(s.X, s.Y)).Mul3(fit)
+	if s.visible = m.Det() != 0; !s.visible {
+		return nil
+	}
+	s.inverse = m.Inv()
+
+	// A sliced image is cut off at the edges of its area.
+	toImage := fit.Inv()
+	corner0 := toImage.Mul3x1(mgl.Vec3{0, 0, 1})
+	corner1 := toImage.Mul3x1(mgl.Vec3{w, h, 1})
+	s.area = [4]float32{
+		float32(math.Max(0, float64(corner0[0]))), float32(math.Max(0, float64(corner0[1]))),
+		float32(math.Min(float64(imgW), float64(corner1[0]))), float32(math.Min(float64(imgH), float64(corner1[1]))),
+	}
+
+	a := s.area
+	corners := transformPoints([]float32{a[0], a[1], a[2], a[1], a[2], a[3], a[0], a[3]}, m)
+	s.bounds = [4]float32{corners[0], corners[1], corners[0], corners[1]}
+	for i := 2; i < len(corners); i += 2 {
+		x, y := corners[i], corners[i+1]
+		if x < s.bounds[0] {
+			s.bounds[0] = x
+		}
+		if y < s.bounds[1] {
+			s.bounds[1] = y
+		}
+		if x > s.bounds[2] {
+			s.bounds[2] = x
+		}
+		if y > s.bounds[3] {
+			s.bounds[3] = y
+		}
+	}
+	return nil
+}
+
+func (s *Image) load(c *compiler) error {
+	data, err := c.load(s.Href)
+	if err != nil {
+		return s.errorf("href", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return s.errorf("href", err)
+	}
+
+	s.img = img
+	return nil
+}
@@ -0,0 +1,42 @@
+package rasterizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestImageSize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	href := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	for _, test := range []struct {
+		attrs string
+		drawn bool
+	}{
+		{``, true},
+		{`width="8"`, true},
+		{`height="8"`, true},
+		{`width="0"`, false},
+		{`height="0"`, false},
+		{`width="8" height="0"`, false},
+		{`width="0mm" height="8"`, false},
+	} {
+		out, err := drawSvg(t, `<image href="`+href+`" `+test.attrs+`/>`)
+		if err != nil {
+			t.Errorf("%s: %v", test.attrs, err)
+			continue
+		}
+		if drawn := out.RGBAAt(1, 1) == red; drawn != test.drawn {
+			t.Errorf("%s: drawn = %v, want %v", test.attrs, drawn, test.drawn)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package rasterizer
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Loader fetches the documents and images that get rendered. Names are slash
+// separated paths. A leading slash is relative to the root of whatever the
+// loader reads from.
+type Loader interface {
+	Load(name string) ([]byte, error)
+}
+
+// FSLoader returns a Loader that reads files from fsys.
+func FSLoader(fsys fs.FS) Loader {
+	return fsLoader{fsys}
+}
+
+type fsLoader struct {
+	fsys fs.FS
+}
+
+func (l fsLoader) Load(name string) ([]byte, error) {
+	return fs.ReadFile(l.fsys, strings.TrimPrefix(path.Clean(name), "/"))
+}
+
+// compiler holds what elements need from the rasterizer while they are
+// compiled.
+type compiler struct {
+	loader   Loader
+	dir      string // Directory of the document that relative hrefs resolve against.
+	elements int    // Elements compiled so far, not counting groups.
+	fonts    []*fontFace
+	// Defined by the groups compiled so far, the first definition of an id
+	// winning.
+	paintServers map[string]PaintServer
+	// Elements compiled so far. Compiling writes into the element, so one
+	// that is in more than one group can't be drawn in all of them.
+	compiled map[Element]bool
+}
+
+// resolve returns the name of the file href refers to.
+func (c *compiler) resolve(href string) string {
+	if strings.HasPrefix(href, "/") {
+		return path.Clean(href)
+	}
+	return path.Join(c.dir, href)
+}
+
+// load returns the contents of the file or data url that href refers to.
+func (c *compiler) load(href string) ([]byte, error) {
+	if strings.HasPrefix(href, "data:") {
+		return decodeDataURL(href)
+	}
+	return c.loader.Load(c.resolve(href))
+}
+
+func decodeDataURL(href string) ([]byte, error) {
+	comma := strings.IndexByte(href, ',')
+	if comma < 0 {
+		return nil, errors.New("data url has no data")
+	}
+	header, data := href[len("data:"):comma], href[comma+1:]
+
+	if strings.HasSuffix(header, ";base64") {
+		// Long data urls are often wrapped over several lines.
+		data = strings.Map(func(c rune) rune {
+			if unicode.IsSpace(c) {
+				return -1
+			}
+			return c
+		}, data)
+		return base64.StdEncoding.DecodeString(data)
+	}
+	decoded, err := url.PathUnescape(data)
+	return []byte(decoded), err
+}
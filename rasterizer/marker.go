@@ -0,0 +1,208 @@
+package rasterizer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// withMarkers returns shape along with copies of the markers its
+// marker-start, marker-mid and marker-end attributes reference, placed on the
+// vertices of points. The markers are drawn after the shape and follow its
+// transform.
+func (b *builder) withMarkers(n *node, shape Element, transform mgl.Mat3, points []float32, closed bool) (Element, error) {
+	start, mid, end := n.property("marker-start"), n.property("marker-mid"), n.property("marker-end")
+	if (start == "" || start == "none") && (mid == "" || mid == "none") && (end == "" || end == "none") {
+		return shape, nil
+	}
+	if len(points) < 2 || len(points)%2 != 0 {
+		return shape, nil
+	}
+	// Markers are only drawn along with their shape, whose visibility is
+	// inherited from the elements around it.
+	if shape.base().Display == "none" {
+		return shape, nil
+	}
+	if v := n.property("visibility"); v == "hidden" || v == "collapse" {
+		return shape, nil
+	}
+
+	strokeWidth := float32(1)
+	if _, ok := n.value("stroke-width"); ok {
+		var err error
+		if strokeWidth, err = n.length("stroke-width"); err != nil {
+			return nil, err
+		}
+	}
+
+	// The vertices along the outline, which for a closed shape ends back on
+	// its first point.
+	vertices := points
+	if closed {
+		vertices = append(append([]float32(nil), points...), points[0], points[1])
+	}
+	count := len(vertices) / 2
+	direction := func(i, j int) float64 {
+		return math.Atan2(float64(vertices[2*j+1]-vertices[2*i+1]), float64(vertices[2*j]-vertices[2*i]))
+	}
+	angles := make([]float64, count)
+	for i := range angles {
+		switch {
+		case count == 1:
+		case i == 0 && closed:
+			angles[i] = bisect(direction(count-2, count-1), direction(0, 1))
+		case i == 0:
+			angles[i] = direction(0, 1)
+		case i == count-1 && closed:
+			angles[i] = angles[0]
+		case i == count-1:
+			angles[i] = direction(i-1, i)
+		default:
+			angles[i] = bisect(direction(i-1, i), direction(i, i+1))
+		}
+	}
+
+	group := &Svg{transformable: transformable{source: n.source}, children: []Element{shape}}
+	add := func(attr string, i int) error {
+		marker, err := b.newMarker(n, attr, vertices[2*i], vertices[2*i+1], angles[i], strokeWidth, transform)
+		if err != nil {
+			return err
+		}
+		if marker != nil {
+			group.children = append(group.children, marker)
+		}
+		return nil
+	}
+	if err := add("marker-start", 0); err != nil {
+		return nil, err
+	}
+	for i := 1; i < count-1; i++ {
+		if err := add("marker-mid", i); err != nil {
+			return nil, err
+		}
+	}
+	if count > 1 {
+		if err := add("marker-end", count-1); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// bisect returns the angle halfway between the direction a path comes into a
+// vertex from and the direction it leaves in.
+func bisect(in, out float64) float64 {
+	turn := math.Remainder(out-in, 2*math.Pi)
+	return in + turn/2
+}
+
+// newMarker builds a copy of the marker referenced by attr of n placed at
+// (x, y), or nil when attr is missing, none or references no marker. angle is
+// the direction of the outline at the vertex, which an orient of auto turns
+// the marker to.
+func (b *builder) newMarker(n *node, attr string, x, y float32, angle float64, strokeWidth float32, transform mgl.Mat3) (*Viewport, error) {
+	v := n.property(attr)
+	if v == "" || v == "none" {
+		return nil, nil
+	}
+	id, err := parseURL(v)
+	if err != nil {
+		return nil, n.errorf(attr, err)
+	}
+	target := b.ids[id]
+	if target == nil || target.element != "marker" {
+		return nil, nil
+	}
+	for _, u := range b.using {
+		if u == target {
+			return nil, n.errorf(attr, fmt.Errorf("circular reference to %q", id))
+		}
+	}
+	b.using = append(b.using, target)
+	defer func() { b.using = b.using[:len(b.using)-1] }()
+
+	s := &Viewport{Overflow: target.property("overflow")}
+	preserveAspectRatio := target.attrs["preserveAspectRatio"]
+	s.Width, s.Height = 3, 3
+	var refX, refY float32
+	for _, l := range []struct {
+		attr string
+		dst  *float32
+	}{{"markerWidth", &s.Width}, {"markerHeight", &s.Height}, {"refX", &refX}, {"refY", &refY}} {
+		if _, ok := target.value(l.attr); !ok {
+			continue
+		}
+		if *l.dst, err = target.length(l.attr); err != nil {
+			return nil, err
+		}
+	}
+	if s.Width < 0 || s.Height < 0 {
+		return nil, target.errorf("markerWidth", fmt.Errorf("negative size %vx%v", s.Width, s.Height))
+	}
+	viewBox, err := target.viewBox()
+	if err != nil {
+		return nil, err
+	}
+
+	switch orient := strings.TrimSpace(target.attrs["orient"]); orient {
+	case "auto":
+	case "auto-start-reverse":
+		if attr == "marker-start" {
+			angle += math.Pi
+		}
+	case "":
+		angle = 0
+	default:
+		degrees, err := strconv.ParseFloat(strings.TrimSuffix(orient, "deg"), 32)
+		if err != nil {
+			return nil, target.errorf("orient", fmt.Errorf("invalid angle %q", orient))
+		}
+		angle = degrees * math.Pi / 180
+	}
+
+	scale := strokeWidth
+	switch target.attrs["markerUnits"] {
+	case "", "strokeWidth":
+	case "userSpaceOnUse":
+		scale = 1
+	default:
+		return nil, target.errorf("markerUnits", fmt.Errorf("unknown units %q", target.attrs["markerUnits"]))
+	}
+
+	// The reference point of the marker, once its viewBox is fit, goes on
+	// the vertex.
+	if viewBox != nil && viewBox[2] > 0 && viewBox[3] > 0 {
+		m, err := viewBoxTransform(viewBox, s.Width, s.Height, preserveAspectRatio)
+		if err != nil {
+			return nil, target.errorf("preserveAspectRatio", err)
+		}
+		ref := m.Mul3x1(mgl.Vec3{refX, refY, 1})
+		refX, refY = ref[0], ref[1]
+	}
+	sin, cos := math.Sincos(angle)
+	rotate := affine(float32(cos), float32(sin), float32(-sin), float32(cos), 0, 0)
+
+	outer := b.viewport
+	b.viewport = [2]float32{s.Width, s.Height}
+	if viewBox != nil {
+		b.viewport = [2]float32{viewBox[2], viewBox[3]}
+	}
+	defer func() { b.viewport = outer }()
+
+	// The contents of a marker inherit from where the marker is declared
+	// rather than from the shape it is placed on.
+	defer b.enter(target, b.inherited(target))()
+	group, err := b.newSvg(target)
+	if err != nil {
+		return nil, err
+	}
+	group.Width, group.Height, group.ViewBox = s.Width, s.Height, viewBox
+	group.PreserveAspectRatio = preserveAspectRatio
+	group.Transform = transform.Mul3(mgl.Translate2D(x, y)).Mul3(rotate).
+		Mul3(mgl.Scale2D(scale, scale)).Mul3(mgl.Translate2D(-refX, -refY))
+	s.Svg = *group
+	return s, nil
+}
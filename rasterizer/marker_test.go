@@ -0,0 +1,39 @@
+package rasterizer
+
+import "testing"
+
+func TestMarkerInheritsFromDeclaration(t *testing.T) {
+	for _, doc := range []string{
+		`<defs fill="red"><marker id="m" markerUnits="userSpaceOnUse" overflow="visible">
+			<rect x="-2" y="-2" width="4" height="4"/></marker></defs>`,
+		`<g fill="red"><defs><marker id="m" markerUnits="userSpaceOnUse" overflow="visible">
+			<rect x="-2" y="-2" width="4" height="4"/></marker></defs></g>`,
+	} {
+		img, err := drawSvg(t, doc+`<line x1="2" y1="5" x2="8" y2="5" fill="blue" marker-end="url(#m)"/>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.RGBAAt(8, 5); got != red {
+			t.Errorf("%s: marker = %v, want %v", doc, got, red)
+		}
+	}
+}
+
+func TestMarkersOfHiddenShapes(t *testing.T) {
+	marker := `<marker id="m" markerUnits="userSpaceOnUse" overflow="visible">
+		<rect x="-2" y="-2" width="4" height="4" fill="red"/></marker>`
+	for _, line := range []string{
+		`<line x1="2" y1="5" x2="8" y2="5" stroke="blue" marker-end="url(#m)" visibility="hidden"/>`,
+		`<g visibility="collapse"><line x1="2" y1="5" x2="8" y2="5" stroke="blue" marker-end="url(#m)"/></g>`,
+		`<line x1="2" y1="5" x2="8" y2="5" stroke="blue" marker-end="url(#m)" display="none"/>`,
+		`<line x1="2" y1="5" x2="8" y2="5" stroke="blue" marker-end="url(#m)" opacity="0"/>`,
+	} {
+		img, err := drawSvg(t, marker+line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.RGBAAt(8, 5); got != white {
+			t.Errorf("%s: marker = %v, want nothing drawn", line, got)
+		}
+	}
+}
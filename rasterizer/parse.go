@@ -0,0 +1,1328 @@
+package rasterizer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// source is where an element was declared. Elements keep it around so that
+// problems found after parsing can still be reported against the document.
+type source struct {
+	element string
+	line    int
+	column  int
+}
+
+func (s source) errorf(attr string, err error) error {
+	return &ParseError{Element: s.element, Attr: attr,
+		Line: s.line, Column: s.column, Err: err}
+}
+
+// node is an element of the parsed document.
+type node struct {
+	source
+	attrs    map[string]string
+	children []*node
+	text     string // Character data, which is only kept inside text and style.
+	style    style  // Presentation properties once css is applied.
+	computed style  // Style along with what it inherits, set as elements are built.
+	// Size of the viewport percentages are of, set as elements are built.
+	viewport [2]float32
+}
+
+// parseDocument builds the element tree of an xml document and returns its
+// root element.
+func parseDocument(data []byte) (*node, error) {
+	// Offsets of the start of every line so decoder offsets can be turned
+	// into a line and column.
+	lineStarts := []int{0}
+	for i, c := range data {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	position := func(offset int64) (int, int) {
+		line := sort.SearchInts(lineStarts, int(offset)+1) - 1
+		return line + 1, int(offset) - lineStarts[line] + 1
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root *node
+	stack := []*node{}
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, column := position(dec.InputOffset())
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				err = errors.New(syntaxErr.Msg)
+			}
+			return nil, &ParseError{Line: line, Column: column, Err: err}
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{attrs: map[string]string{}}
+			n.element = t.Name.Local
+			n.line, n.column = position(offset)
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, n.errorf("", errors.New("multiple root elements"))
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				break
+			}
+			parent := stack[len(stack)-1]
+			if parent.element == "style" {
+				parent.text += string(t)
+			}
+			if parent.element == "text" || parent.element == "tspan" {
+				line, column := position(offset)
+				n := &node{source: source{line: line, column: column}, text: string(t)}
+				parent.children = append(parent.children, n)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, &ParseError{Line: 1, Column: 1, Err: errors.New("document has no elements")}
+	}
+	if root.element != "svg" {
+		return nil, root.errorf("", errors.New("root element must be <svg>"))
+	}
+	applyStyles(root)
+	return root, nil
+}
+
+// Size of each unit in user units (px).
+var lengthUnits = map[string]float32{
+	"":   1,
+	"px": 1,
+	"pt": 4.0 / 3.0,
+	"pc": 16,
+	"mm": 96 / 25.4,
+	"cm": 96 / 2.54,
+	"in": 96,
+}
+
+func parseLength(s string) (float32, error) {
+	f, unit, err := splitLength(s)
+	if err != nil {
+		return 0, err
+	}
+	size, ok := lengthUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", unit)
+	}
+	return f * size, nil
+}
+
+// splitLength splits a length such as "12.5px" into its number and unit.
+func splitLength(s string) (float32, string, error) {
+	s = strings.TrimSpace(s)
+	i := len(s)
+	for i > 0 && (s[i-1] >= 'a' && s[i-1] <= 'z' || s[i-1] == '%') {
+		i--
+	}
+
+	f, err := strconv.ParseFloat(s[:i], 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid length %q", s)
+	}
+	return float32(f), s[i:], nil
+}
+
+// parsePercentage returns a percentage such as "50%" as a fraction.
+func parsePercentage(s string) (float32, error) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length %q", s)
+	}
+	return float32(f) / 100, nil
+}
+
+// percentOf says which size of the viewport a percentage of an attribute is
+// of, 0 for the width and 1 for the height. Attributes missing from it are of
+// the diagonal, see viewportSize.
+var percentOf = map[string]int{
+	"x": 0, "cx": 0, "rx": 0, "x1": 0, "x2": 0, "dx": 0, "width": 0, "markerWidth": 0, "refX": 0,
+	"y": 1, "cy": 1, "ry": 1, "y1": 1, "y2": 1, "dy": 1, "height": 1, "markerHeight": 1, "refY": 1,
+}
+
+// viewportSize returns the width (i = 0) or height (i = 1) of viewport, or
+// for anything else its diagonal over the square root of 2.
+func viewportSize(viewport [2]float32, i int) float32 {
+	if i == 0 || i == 1 {
+		return viewport[i]
+	}
+	return float32(math.Hypot(float64(viewport[0]), float64(viewport[1])) / math.Sqrt2)
+}
+
+// length returns the attribute as a length in user units or 0 if it is
+// missing.
+func (n *node) length(attr string) (float32, error) {
+	v, ok := n.value(attr)
+	if !ok {
+		return 0, nil
+	}
+	f, unit, err := splitLength(v)
+	if err != nil {
+		return 0, n.errorf(attr, err)
+	}
+	if f, err = n.units(attr, f, unit); err != nil {
+		return 0, n.errorf(attr, err)
+	}
+	return f, nil
+}
+
+// units returns f, given in unit by attr, in user units. A percentage is of
+// the size of the viewport that percentOf gives, em and ex are of the font
+// size of n.
+func (n *node) units(attr string, f float32, unit string) (float32, error) {
+	switch unit {
+	case "%":
+		i, ok := percentOf[attr]
+		if !ok {
+			i = 2
+		}
+		return f / 100 * viewportSize(n.viewport, i), nil
+	case "em", "ex":
+		size, err := parseFontSize(n.property("font-size"), 16)
+		if err != nil {
+			return 0, fmt.Errorf("font-size: %v", err)
+		}
+		if unit == "ex" {
+			size /= 2
+		}
+		return f * size, nil
+	}
+	size, ok := lengthUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", unit)
+	}
+	return f * size, nil
+}
+
+// number returns the attribute as a plain number or 0 if it is missing.
+func (n *node) number(attr string) (float32, error) {
+	v, ok := n.value(attr)
+	if !ok {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 32)
+	if err != nil {
+		return 0, n.errorf(attr, fmt.Errorf("invalid number %q", v))
+	}
+	return float32(f), nil
+}
+
+// lengths reads several length attributes at once, stopping at the first
+// error.
+func (n *node) lengths(attrs []string, dst ...*float32) error {
+	for i, attr := range attrs {
+		f, err := n.length(attr)
+		if err != nil {
+			return err
+		}
+		*dst[i] = f
+	}
+	return nil
+}
+
+// lengthList returns the attribute as a list of lengths or nil if it is
+// missing.
+func (n *node) lengthList(attr string) ([]float32, error) {
+	v, _ := n.value(attr)
+	p := &pathScanner{s: v}
+	var lengths []float32
+	for p.skipSeparators(); p.i < len(p.s); p.skipSeparators() {
+		f, err := p.number()
+		if err != nil {
+			return nil, n.errorf(attr, err)
+		}
+		start := p.i
+		for p.i < len(p.s) && (p.s[p.i] >= 'a' && p.s[p.i] <= 'z' || p.s[p.i] == '%') {
+			p.i++
+		}
+		if f, err = n.units(attr, f, p.s[start:p.i]); err != nil {
+			return nil, n.errorf(attr, err)
+		}
+		lengths = append(lengths, f)
+	}
+	return lengths, nil
+}
+
+// newTransformable holds the attributes shared by every element.
+func newTransformable(n *node) (transformable, error) {
+	t := transformable{source: n.source}
+	transform, err := parseTransform(n.attrs["transform"])
+	if err != nil {
+		return t, n.errorf("transform", err)
+	}
+	t.Transform = transform
+
+	t.Display = n.property("display")
+	switch v := n.property("visibility"); v {
+	case "", "inherit":
+	case "visible", "hidden", "collapse":
+		t.Visibility = v
+	default:
+		return t, n.errorf("visibility", fmt.Errorf("unknown visibility %q", v))
+	}
+
+	for _, attr := range []string{"fill", "stroke"} {
+		v := n.paint(attr)
+		if strings.HasPrefix(v, "url(") {
+			// The paint server is looked up once the document is built,
+			// only the color to fall back on is checked here.
+			_, fallback, err := parsePaintURL(v)
+			if err != nil {
+				return t, n.errorf(attr, err)
+			}
+			v = fallback
+		}
+		if v != "" {
+			if _, _, err := parseColor(v); err != nil {
+				return t, n.errorf(attr, err)
+			}
+		}
+	}
+
+	// Nothing shows through an opacity of 0, so the element is left out as if
+	// it wasn't displayed.
+	if v := n.property("opacity"); v != "" && v != "inherit" {
+		opacity, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return t, n.errorf("opacity", fmt.Errorf("invalid number %q", v))
+		}
+		if opacity <= 0 {
+			t.Display = "none"
+		}
+	}
+	return t, nil
+}
+
+// value returns an attribute of n, or the value css gives it for a
+// presentation property.
+func (n *node) value(attr string) (string, bool) {
+	if presentationProperties[attr] {
+		if n.computed != nil {
+			v, ok := n.computed[attr]
+			return v, ok
+		}
+		v, ok := n.style[attr]
+		return v, ok
+	}
+	v, ok := n.attrs[attr]
+	return v, ok
+}
+
+// property returns a presentation property of n or "" if it isn't set.
+func (n *node) property(name string) string {
+	v, _ := n.value(name)
+	return strings.TrimSpace(v)
+}
+
+// paint returns the fill or stroke of n with currentColor replaced by its
+// color.
+func (n *node) paint(attr string) string {
+	v := n.property(attr)
+	if strings.EqualFold(v, "currentcolor") {
+		switch color := n.property("color"); strings.ToLower(color) {
+		case "", "currentcolor":
+		default:
+			return color
+		}
+	}
+	return v
+}
+
+// opacity returns the attribute as an opacity, which is 1 when it is missing.
+func (n *node) opacity(attr string) (float32, error) {
+	if _, ok := n.value(attr); !ok {
+		return 1, nil
+	}
+	return n.number(attr)
+}
+
+// points returns the attribute as a list of x, y pairs.
+func (n *node) points(attr string) ([]float32, error) {
+	points, err := parsePoints(n.attrs[attr])
+	if err != nil {
+		return nil, n.errorf(attr, err)
+	}
+	return points, nil
+}
+
+// newDocument builds the root of a document. A missing or relative width or
+// height falls back to the size of the viewBox.
+func newDocument(n *node) (*Svg, error) {
+	viewBox, err := n.viewBox()
+	if err != nil {
+		return nil, err
+	}
+
+	dimension := func(attr string, i int) (float32, error) {
+		v := n.attrs[attr]
+		if v == "" || strings.HasSuffix(v, "%") {
+			if viewBox == nil {
+				return 0, n.errorf(attr, errors.New("missing and no viewBox to fall back on"))
+			}
+			return viewBox[i], nil
+		}
+		return n.length(attr)
+	}
+	width, err := dimension("width", 2)
+	if err != nil {
+		return nil, err
+	}
+	height, err := dimension("height", 3)
+	if err != nil {
+		return nil, err
+	}
+	// A size of 0 is allowed and draws nothing.
+	if width < 0 {
+		return nil, n.errorf("width", fmt.Errorf("negative width %v", width))
+	}
+	if height < 0 {
+		return nil, n.errorf("height", fmt.Errorf("negative height %v", height))
+	}
+
+	b := newBuilder(n)
+	b.viewport = [2]float32{width, height}
+	if viewBox != nil {
+		b.viewport = [2]float32{viewBox[2], viewBox[3]}
+	}
+	b.enter(n, nil)
+	s, err := b.newSvg(n)
+	if err != nil {
+		return nil, err
+	}
+	s.Width, s.Height, s.ViewBox = width, height, viewBox
+	s.PreserveAspectRatio = n.attrs["preserveAspectRatio"]
+	if err := b.definePaintServers(s, n); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// viewBox returns the viewBox attribute or nil if it is missing.
+func (n *node) viewBox() ([]float32, error) {
+	v, ok := n.attrs["viewBox"]
+	if !ok {
+		return nil, nil
+	}
+	viewBox, err := parseNumbers(v)
+	if err != nil || len(viewBox) != 4 {
+		return nil, n.errorf("viewBox", fmt.Errorf("expected 4 numbers in %q", v))
+	}
+	if viewBox[2] < 0 || viewBox[3] < 0 {
+		return nil, n.errorf("viewBox", fmt.Errorf("negative size in %q", v))
+	}
+	return viewBox, nil
+}
+
+// parseURL returns the id a reference such as url(#arrow) points at.
+func parseURL(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if !strings.HasPrefix(v, "url(") || !strings.HasSuffix(v, ")") {
+		return "", fmt.Errorf("expected url(#id), got %q", v)
+	}
+	ref := strings.Trim(strings.TrimSpace(v[4:len(v)-1]), `"'`)
+	if !strings.HasPrefix(ref, "#") {
+		return "", fmt.Errorf("expected a reference to an element of the document, got %q", ref)
+	}
+	return ref[1:], nil
+}
+
+// builder turns the nodes of a document into elements. It knows every id in
+// the document so that <use> can build a copy of what it references.
+type builder struct {
+	ids      map[string]*node
+	parents  map[*node]*node
+	using    []*node    // Nodes being copied by <use>, innermost last.
+	viewport [2]float32 // Size of the innermost viewport in its own user units.
+	style    style      // Computed style of the element being built.
+}
+
+// enter works out the computed style of n inside an element with the
+// computed style parent, which the elements built in n then inherit, and
+// places n in the current viewport. The returned function goes back to the
+// style before.
+func (b *builder) enter(n *node, parent style) func() {
+	outer := b.style
+	n.computed = computeStyle(n.style, parent)
+	n.viewport = b.viewport
+	b.style = n.computed
+	return func() { b.style = outer }
+}
+
+func newBuilder(root *node) *builder {
+	b := &builder{ids: map[string]*node{}, parents: map[*node]*node{}}
+	var index func(n *node)
+	index = func(n *node) {
+		// The first element with an id wins.
+		if id := n.attrs["id"]; id != "" && b.ids[id] == nil {
+			b.ids[id] = n
+		}
+		for _, c := range n.children {
+			b.parents[c] = n
+			index(c)
+		}
+	}
+	index(root)
+	return b
+}
+
+// inherited returns the computed style n inherits from the elements it is
+// declared in.
+func (b *builder) inherited(n *node) style {
+	var ancestors []*node
+	for p := b.parents[n]; p != nil; p = b.parents[p] {
+		ancestors = append(ancestors, p)
+	}
+	var s style
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		s = computeStyle(ancestors[i].style, s)
+	}
+	return s
+}
+
+// newElement returns nil for elements that aren't drawn where they are
+// declared, like the contents of <defs>, or aren't supported.
+func (b *builder) newElement(n *node) (Element, error) {
+	// A copy made by <use> inherits from the <use> rather than from where
+	// it is declared.
+	defer b.enter(n, b.style)()
+
+	switch n.element {
+	case "rect":
+		return newRect(n)
+	case "line":
+		s, err := newLine(n)
+		if err != nil {
+			return nil, err
+		}
+		return b.withMarkers(n, s, s.Transform, []float32{s.X1, s.Y1, s.X2, s.Y2}, false)
+	case "polyline":
+		s, err := newPolyline(n)
+		if err != nil {
+			return nil, err
+		}
+		return b.withMarkers(n, s, s.Transform, s.Points, false)
+	case "polygon":
+		s, err := newPolygon(n)
+		if err != nil {
+			return nil, err
+		}
+		return b.withMarkers(n, s, s.Transform, s.Points, true)
+	case "path":
+		return newPath(n)
+	case "circle":
+		return newCircle(n)
+	case "ellipse":
+		return newEllipse(n)
+	case "g":
+		return b.newSvg(n)
+	case "svg":
+		return b.newViewport(n)
+	case "use":
+		s, err := b.newUse(n)
+		if s == nil {
+			return nil, err
+		}
+		return s, nil
+	case "image":
+		return newImage(n)
+	case "text":
+		return newText(n)
+	}
+	return nil, nil
+}
+
+func (b *builder) newSvg(n *node) (*Svg, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Svg{transformable: t}
+
+	for _, c := range n.children {
+		child, err := b.newElement(c)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			s.children = append(s.children, child)
+		}
+	}
+
+	return s, nil
+}
+
+// newViewport builds a nested svg. A missing width or height fills the
+// viewport around it.
+func (b *builder) newViewport(n *node) (*Viewport, error) {
+	s := &Viewport{Overflow: n.property("overflow")}
+	var err error
+	if s.X, err = b.viewportLength(n, "x", 0, "0"); err != nil {
+		return nil, err
+	}
+	if s.Y, err = b.viewportLength(n, "y", 1, "0"); err != nil {
+		return nil, err
+	}
+	if s.Width, err = b.viewportLength(n, "width", 0, "100%"); err != nil {
+		return nil, err
+	}
+	if s.Height, err = b.viewportLength(n, "height", 1, "100%"); err != nil {
+		return nil, err
+	}
+	if s.Width < 0 {
+		return nil, n.errorf("width", fmt.Errorf("negative width %v", s.Width))
+	}
+	if s.Height < 0 {
+		return nil, n.errorf("height", fmt.Errorf("negative height %v", s.Height))
+	}
+	viewBox, err := n.viewBox()
+	if err != nil {
+		return nil, err
+	}
+
+	outer := b.viewport
+	b.viewport = [2]float32{s.Width, s.Height}
+	if viewBox != nil {
+		b.viewport = [2]float32{viewBox[2], viewBox[3]}
+	}
+	defer func() { b.viewport = outer }()
+
+	group, err := b.newSvg(n)
+	if err != nil {
+		return nil, err
+	}
+	group.Width, group.Height, group.ViewBox = s.Width, s.Height, viewBox
+	group.PreserveAspectRatio = n.attrs["preserveAspectRatio"]
+	s.Svg = *group
+	return s, nil
+}
+
+// viewportLength returns a length of a nested svg, which as a percentage is
+// of the width (i = 0) or height (i = 1) of the viewport around it.
+func (b *builder) viewportLength(n *node, attr string, i int, missing string) (float32, error) {
+	v := strings.TrimSpace(n.attrs[attr])
+	if v == "" || v == "auto" {
+		v = missing
+	}
+	if strings.HasSuffix(v, "%") {
+		f, err := parsePercentage(v)
+		if err != nil {
+			return 0, n.errorf(attr, err)
+		}
+		return f * b.viewport[i], nil
+	}
+	f, err := parseLength(v)
+	if err != nil {
+		return 0, n.errorf(attr, err)
+	}
+	return f, nil
+}
+
+// newUse builds a group holding a copy of the element referenced by href,
+// moved by x and y, or nil when href doesn't reference an element of the
+// document. Elements are compiled in place so every <use> needs a copy of its
+// own.
+func (b *builder) newUse(n *node) (*Svg, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	var x, y, width, height float32
+	err = n.lengths([]string{"x", "y", "width", "height"}, &x, &y, &width, &height)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only elements of the document can be referenced, anything else,
+	// including elements of other files, draws nothing.
+	href := n.attrs["href"]
+	if !strings.HasPrefix(href, "#") {
+		return nil, nil
+	}
+	target := b.ids[href[1:]]
+	if target == nil {
+		return nil, nil
+	}
+	for _, u := range b.using {
+		if u == target {
+			return nil, n.errorf("href", fmt.Errorf("circular reference to %q", href[1:]))
+		}
+	}
+	b.using = append(b.using, target)
+	defer func() { b.using = b.using[:len(b.using)-1] }()
+
+	var child Element
+	if target.element == "symbol" {
+		if child, err = b.newSymbol(target); err != nil {
+			return nil, err
+		}
+	} else if child, err = b.newElement(target); err != nil {
+		return nil, err
+	}
+
+	// The size of a <use> replaces the size of an svg or symbol it
+	// references.
+	if v, ok := child.(*Viewport); ok {
+		if _, ok := n.attrs["width"]; ok {
+			v.Width = width
+		}
+		if _, ok := n.attrs["height"]; ok {
+			v.Height = height
+		}
+	}
+
+	t.Transform = t.Transform.Mul3(mgl.Translate2D(x, y))
+	s := &Svg{transformable: t}
+	if child != nil {
+		s.children = []Element{child}
+	}
+	return s, nil
+}
+
+// newSymbol builds a symbol like a nested svg, so its contents are clipped
+// to its viewport. The <use> referencing it can give it a size.
+func (b *builder) newSymbol(n *node) (*Viewport, error) {
+	defer b.enter(n, b.style)()
+	return b.newViewport(n)
+}
+
+// definePaintServers defines on s every gradient of the document rooted at
+// root. Gradients can be used from anywhere, so their stops inherit from
+// where they are declared rather than from what they paint.
+func (b *builder) definePaintServers(s *Svg, root *node) error {
+	var gradients []*node
+	var walk func(n *node, parent style)
+	walk = func(n *node, parent style) {
+		n.computed = computeStyle(n.style, parent)
+		if n.element == "linearGradient" || n.element == "radialGradient" {
+			gradients = append(gradients, n)
+		}
+		for _, c := range n.children {
+			walk(c, n.computed)
+		}
+	}
+	walk(root, nil)
+
+	for _, n := range gradients {
+		id := n.attrs["id"]
+		if id == "" || b.ids[id] != n {
+			continue
+		}
+		var g PaintServer
+		var err error
+		if n.element == "linearGradient" {
+			g, err = b.newLinearGradient(n)
+		} else {
+			g, err = b.newRadialGradient(n)
+		}
+		if err != nil {
+			return err
+		}
+		s.Define(id, g)
+	}
+	return nil
+}
+
+// gradientChain returns n followed by the gradients it references through
+// href, which fill in the attributes and stops it leaves out. A reference to
+// something other than a gradient ends the chain.
+func (b *builder) gradientChain(n *node) ([]*node, error) {
+	chain := []*node{n}
+	for {
+		last := chain[len(chain)-1]
+		href, ok := last.attrs["href"]
+		if !ok {
+			return chain, nil
+		}
+		if !strings.HasPrefix(href, "#") {
+			return nil, last.errorf("href", fmt.Errorf("expected a reference to an element of the document, got %q", href))
+		}
+		target := b.ids[href[1:]]
+		if target == nil || target.element != "linearGradient" && target.element != "radialGradient" {
+			return chain, nil
+		}
+		for _, c := range chain {
+			if c == target {
+				return nil, last.errorf("href", fmt.Errorf("circular reference to %q", href[1:]))
+			}
+		}
+		chain = append(chain, target)
+	}
+}
+
+// gradientAttr returns the first gradient of chain that has attr, only
+// looking at gradients of the given element when it isn't empty.
+func gradientAttr(chain []*node, element, attr string) (*node, bool) {
+	for _, n := range chain {
+		if element != "" && n.element != element {
+			continue
+		}
+		if _, ok := n.attrs[attr]; ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// newGradient reads the attributes shared by linear and radial gradients
+// from chain, which is given by gradientChain.
+func newGradient(chain []*node) (Gradient, error) {
+	var g Gradient
+	if n, ok := gradientAttr(chain, "", "gradientUnits"); ok {
+		switch v := strings.TrimSpace(n.attrs["gradientUnits"]); v {
+		case "objectBoundingBox":
+		case "userSpaceOnUse":
+			g.UserSpace = true
+		default:
+			return g, n.errorf("gradientUnits", fmt.Errorf("unknown units %q", v))
+		}
+	}
+	if n, ok := gradientAttr(chain, "", "gradientTransform"); ok {
+		transform, err := parseTransform(n.attrs["gradientTransform"])
+		if err != nil {
+			return g, n.errorf("gradientTransform", err)
+		}
+		g.Transform = transform
+	}
+	if n, ok := gradientAttr(chain, "", "spreadMethod"); ok {
+		switch v := strings.TrimSpace(n.attrs["spreadMethod"]); v {
+		case "pad", "reflect", "repeat":
+			g.Spread = v
+		default:
+			return g, n.errorf("spreadMethod", fmt.Errorf("unknown spread method %q", v))
+		}
+	}
+
+	// The stops come from the first gradient that has any.
+	for _, n := range chain {
+		for _, c := range n.children {
+			if c.element != "stop" {
+				continue
+			}
+			stop, err := newGradientStop(c)
+			if err != nil {
+				return g, err
+			}
+			g.Stops = append(g.Stops, stop)
+		}
+		if len(g.Stops) > 0 {
+			break
+		}
+	}
+	return g, nil
+}
+
+func newGradientStop(n *node) (GradientStop, error) {
+	s := GradientStop{Color: n.paint("stop-color")}
+	if s.Color == "" {
+		s.Color = "black"
+	}
+	if _, _, err := parseColor(s.Color); err != nil {
+		return s, n.errorf("stop-color", err)
+	}
+
+	if v := strings.TrimSpace(n.attrs["offset"]); v != "" {
+		scale := 1.0
+		if strings.HasSuffix(v, "%") {
+			v, scale = strings.TrimSuffix(v, "%"), 0.01
+		}
+		offset, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return s, n.errorf("offset", fmt.Errorf("invalid offset %q", n.attrs["offset"]))
+		}
+		s.Offset = float32(offset * scale)
+	}
+
+	var err error
+	if s.Opacity, err = n.opacity("stop-opacity"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// gradientLength returns a coordinate of a gradient from chain, or missing
+// if none of them has it. In the bounding box a percentage is a fraction of
+// it, in user space it is of the width (i = 0) or height (i = 1) of the
+// viewport, or of its diagonal over the square root of 2 (i = 2).
+func (b *builder) gradientLength(chain []*node, element, attr, missing string, userSpace bool, i int) (float32, error) {
+	n, ok := gradientAttr(chain, element, attr)
+	v := missing
+	if ok {
+		v = strings.TrimSpace(n.attrs[attr])
+	}
+	if strings.HasSuffix(v, "%") {
+		f, err := parsePercentage(v)
+		if err != nil {
+			return 0, n.errorf(attr, err)
+		}
+		if !userSpace {
+			return f, nil
+		}
+		return f * viewportSize(b.viewport, i), nil
+	}
+	f, err := parseLength(v)
+	if err != nil {
+		return 0, n.errorf(attr, err)
+	}
+	return f, nil
+}
+
+func (b *builder) newLinearGradient(n *node) (*LinearGradient, error) {
+	chain, err := b.gradientChain(n)
+	if err != nil {
+		return nil, err
+	}
+	g, err := newGradient(chain)
+	if err != nil {
+		return nil, err
+	}
+	s := &LinearGradient{Gradient: g}
+	for _, l := range []struct {
+		attr, missing string
+		i             int
+		dst           *float32
+	}{{"x1", "0%", 0, &s.X1}, {"y1", "0%", 1, &s.Y1}, {"x2", "100%", 0, &s.X2}, {"y2", "0%", 1, &s.Y2}} {
+		if *l.dst, err = b.gradientLength(chain, "linearGradient", l.attr, l.missing, g.UserSpace, l.i); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// newRadialGradient builds a radial gradient, whose focal point is its
+// center unless it says otherwise.
+func (b *builder) newRadialGradient(n *node) (*RadialGradient, error) {
+	chain, err := b.gradientChain(n)
+	if err != nil {
+		return nil, err
+	}
+	g, err := newGradient(chain)
+	if err != nil {
+		return nil, err
+	}
+	s := &RadialGradient{Gradient: g}
+	for _, l := range []struct {
+		attr, missing string
+		i             int
+		dst           *float32
+	}{{"cx", "50%", 0, &s.Cx}, {"cy", "50%", 1, &s.Cy}, {"r", "50%", 2, &s.R}, {"fr", "0%", 2, &s.Fr}} {
+		if *l.dst, err = b.gradientLength(chain, "radialGradient", l.attr, l.missing, g.UserSpace, l.i); err != nil {
+			return nil, err
+		}
+	}
+	s.Fx, s.Fy = s.Cx, s.Cy
+	if _, ok := gradientAttr(chain, "radialGradient", "fx"); ok {
+		if s.Fx, err = b.gradientLength(chain, "radialGradient", "fx", "", g.UserSpace, 0); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := gradientAttr(chain, "radialGradient", "fy"); ok {
+		if s.Fy, err = b.gradientLength(chain, "radialGradient", "fy", "", g.UserSpace, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, l := range []struct {
+		attr string
+		r    float32
+	}{{"r", s.R}, {"fr", s.Fr}} {
+		if l.r < 0 {
+			n, _ := gradientAttr(chain, "radialGradient", l.attr)
+			return nil, n.errorf(l.attr, fmt.Errorf("negative radius %v", l.r))
+		}
+	}
+	return s, nil
+}
+
+func newRect(n *node) (*Rect, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Rect{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+	}
+	err = n.lengths([]string{"x", "y", "width", "height"},
+		&s.X, &s.Y, &s.Width, &s.Height)
+	if err != nil {
+		return nil, err
+	}
+	if s.Width < 0 {
+		return nil, n.errorf("width", fmt.Errorf("negative width %v", s.Width))
+	}
+	if s.Height < 0 {
+		return nil, n.errorf("height", fmt.Errorf("negative height %v", s.Height))
+	}
+
+	// A missing or auto radius is the same as the other one.
+	rx, hasRx, err := n.radius("rx")
+	if err != nil {
+		return nil, err
+	}
+	ry, hasRy, err := n.radius("ry")
+	if err != nil {
+		return nil, err
+	}
+	if !hasRx {
+		rx = ry
+	}
+	if !hasRy {
+		ry = rx
+	}
+	s.Rx, s.Ry = rx, ry
+
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// radius returns a corner radius of a rect or a radius of an ellipse and
+// whether it was given, auto counts as not given.
+func (n *node) radius(attr string) (float32, bool, error) {
+	if v := strings.TrimSpace(n.attrs[attr]); v == "" || v == "auto" {
+		return 0, false, nil
+	}
+	r, err := n.length(attr)
+	if err != nil {
+		return 0, false, err
+	}
+	if r < 0 {
+		return 0, false, n.errorf(attr, fmt.Errorf("negative radius %v", r))
+	}
+	return r, true, nil
+}
+
+func newLine(n *node) (*Line, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Line{
+		transformable: t,
+		Stroke:        n.paint("stroke"),
+	}
+	err = n.lengths([]string{"x1", "y1", "x2", "y2"},
+		&s.X1, &s.Y1, &s.X2, &s.Y2)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newPolyline(n *node) (*Polyline, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Polyline{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+		FillRule:      n.property("fill-rule"),
+	}
+	if s.Points, err = n.points("points"); err != nil {
+		return nil, err
+	}
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newCircle(n *node) (*Circle, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Circle{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+	}
+	err = n.lengths([]string{"cx", "cy", "r"}, &s.Cx, &s.Cy, &s.R)
+	if err != nil {
+		return nil, err
+	}
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newEllipse(n *node) (*Ellipse, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Ellipse{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+	}
+	err = n.lengths([]string{"cx", "cy"}, &s.Cx, &s.Cy)
+	if err != nil {
+		return nil, err
+	}
+	// A missing or auto radius is the same as the other one.
+	rx, hasRx, err := n.radius("rx")
+	if err != nil {
+		return nil, err
+	}
+	ry, hasRy, err := n.radius("ry")
+	if err != nil {
+		return nil, err
+	}
+	if !hasRx {
+		rx = ry
+	}
+	if !hasRy {
+		ry = rx
+	}
+	s.Rx, s.Ry = rx, ry
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newPolygon(n *node) (*Polygon, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Polygon{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+		FillRule:      n.property("fill-rule"),
+	}
+	if s.Points, err = n.points("points"); err != nil {
+		return nil, err
+	}
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newPath(n *node) (*Path, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Path{
+		transformable: t,
+		Fill:          n.paint("fill"),
+		Stroke:        n.paint("stroke"),
+		FillRule:      n.property("fill-rule"),
+	}
+	if err := parsePathData(n.attrs["d"], s); err != nil {
+		return nil, n.errorf("d", err)
+	}
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newImage(n *node) (*Image, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Image{
+		transformable:       t,
+		Href:                n.attrs["href"],
+		PreserveAspectRatio: n.attrs["preserveAspectRatio"],
+	}
+	err = n.lengths([]string{"x", "y", "width", "height"},
+		&s.X, &s.Y, &s.Width, &s.Height)
+	if err != nil {
+		return nil, err
+	}
+	if s.Width < 0 {
+		return nil, n.errorf("width", fmt.Errorf("negative width %v", s.Width))
+	}
+	if s.Height < 0 {
+		return nil, n.errorf("height", fmt.Errorf("negative height %v", s.Height))
+	}
+	// A zero Width or Height takes the size of the image, but a width or
+	// height of 0 given in the document hides it.
+	for _, l := range []struct {
+		attr string
+		v    float32
+	}{{"width", s.Width}, {"height", s.Height}} {
+		if _, ok := n.value(l.attr); ok && l.v == 0 {
+			s.Display = "none"
+		}
+	}
+	return s, nil
+}
+
+func newText(n *node) (*Text, error) {
+	t, err := newTransformable(n)
+	if err != nil {
+		return nil, err
+	}
+	span, err := newTextSpan(n)
+	if err != nil {
+		return nil, err
+	}
+	collapseSpaces(span)
+
+	s := &Text{transformable: t, TextSpan: *span}
+	if s.FillOpacity, err = n.opacity("fill-opacity"); err != nil {
+		return nil, err
+	}
+	if s.StrokeOpacity, err = n.opacity("stroke-opacity"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newTextSpan builds the span of a <text> or <tspan>. Bolder and lighter
+// weights are relative to the weight of the span around it.
+func newTextSpan(n *node) (*TextSpan, error) {
+	s := &TextSpan{
+		FontFamily: n.property("font-family"),
+		TextAnchor: n.property("text-anchor"),
+		Fill:       n.paint("fill"),
+		Stroke:     n.paint("stroke"),
+	}
+	switch s.TextAnchor {
+	case "", "start", "middle", "end":
+	default:
+		return nil, n.errorf("text-anchor", fmt.Errorf("unknown anchor %q", s.TextAnchor))
+	}
+
+	var err error
+	lists := []struct {
+		attr string
+		dst  *[]float32
+	}{{"x", &s.X}, {"y", &s.Y}, {"dx", &s.DX}, {"dy", &s.DY}}
+	for _, l := range lists {
+		if *l.dst, err = n.lengthList(l.attr); err != nil {
+			return nil, err
+		}
+	}
+	// The computed font size is already in user units, unless it is
+	// invalid.
+	if v, ok := n.value("font-size"); ok {
+		if s.FontSize, err = parseFontSize(v, 16); err != nil {
+			return nil, n.errorf("font-size", err)
+		}
+		if s.FontSize < 0 {
+			return nil, n.errorf("font-size", fmt.Errorf("negative size %v", s.FontSize))
+		}
+		s.zeroSize = s.FontSize == 0
+	}
+	if s.FontWeight, err = parseFontWeight(n.property("font-weight"), 400); err != nil {
+		return nil, n.errorf("font-weight", err)
+	}
+
+	for _, c := range n.children {
+		switch c.element {
+		case "":
+			s.children = append(s.children, &TextSpan{Text: c.text})
+		case "tspan":
+			c.computed = computeStyle(c.style, n.computed)
+			c.viewport = n.viewport
+			child, err := newTextSpan(c)
+			if err != nil {
+				return nil, err
+			}
+			s.children = append(s.children, child)
+		}
+	}
+	return s, nil
+}
+
+// collapseSpaces turns every run of whitespace in the text of s and the spans
+// in it into a single space, dropping it altogether at the start and end.
+func collapseSpaces(s *TextSpan) {
+	space := true
+	var last *TextSpan
+	var collapse func(s *TextSpan)
+	collapse = func(s *TextSpan) {
+		var b strings.Builder
+		for _, r := range s.Text {
+			switch r {
+			case ' ', '\t', '\n', '\r':
+				if space {
+					continue
+				}
+				space = true
+				r = ' '
+			default:
+				space = false
+			}
+			b.WriteRune(r)
+		}
+		s.Text = b.String()
+		if s.Text != "" {
+			last = s
+		}
+		for _, child := range s.children {
+			collapse(child)
+		}
+	}
+	collapse(s)
+	if last != nil {
+		last.Text = strings.TrimSuffix(last.Text, " ")
+	}
+}
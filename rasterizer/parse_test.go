@@ -0,0 +1,105 @@
+package rasterizer
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// drawSvg draws doc, a document of 10 by 10 without its root element.
+func drawSvg(t *testing.T, doc string) (*image.RGBA, error) {
+	t.Helper()
+	r := New()
+	err := r.SetSvg([]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10">` + doc + `</svg>`))
+	if err != nil {
+		return nil, err
+	}
+	return r.Draw()
+}
+
+var (
+	white = color.RGBA{255, 255, 255, 255}
+	red   = color.RGBA{255, 0, 0, 255}
+)
+
+func TestCircularReferences(t *testing.T) {
+	for _, doc := range []string{
+		`<use id="a" href="#a"/>`,
+		`<g id="a"><use href="#b"/></g><use id="b" href="#a"/>`,
+		`<symbol id="a"><use href="#a"/></symbol><use href="#a"/>`,
+		`<marker id="m"><line x2="1" stroke="red" marker-start="url(#m)"/></marker>
+		<line x2="5" stroke="red" marker-start="url(#m)"/>`,
+		`<marker id="m"><use href="#l"/></marker>
+		<line id="l" x2="5" stroke="red" marker-end="url(#m)"/>`,
+	} {
+		_, err := drawSvg(t, doc)
+		if err == nil || !strings.Contains(err.Error(), "circular reference") {
+			t.Errorf("%s: error = %v, want a circular reference", doc, err)
+		}
+	}
+}
+
+// TestUnresolvedReferences draws references to nothing, which are left out
+// rather than failing the document.
+func TestUnresolvedReferences(t *testing.T) {
+	for _, doc := range []string{
+		`<use/>`,
+		`<use href="#missing"/>`,
+		`<use href="other.svg#a"/>`,
+		`<use href="data:image/svg+xml,&lt;svg/&gt;"/>`,
+		`<line x2="10" y1="5" y2="5" marker-end="url(#missing)"/>`,
+		`<rect id="r" width="5" height="5" display="none"/>
+		<line x2="10" y1="5" y2="5" marker-end="url(#r)"/>`,
+	} {
+		img, err := drawSvg(t, doc)
+		if err != nil {
+			t.Errorf("%s: %v", doc, err)
+			continue
+		}
+		if got := img.RGBAAt(9, 5); got != white {
+			t.Errorf("%s: pixel (9, 5) = %v, want nothing drawn", doc, got)
+		}
+	}
+}
+
+func TestSymbolIsClipped(t *testing.T) {
+	img, err := drawSvg(t, `<symbol id="s" viewBox="0 0 2 2">
+		<rect x="-2" y="-2" width="6" height="6" fill="red"/>
+	</symbol>
+	<use href="#s" x="2" y="2" width="4" height="4"/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 2, red}, {5, 5, red},
+		{1, 1, white}, {6, 6, white}, {1, 4, white},
+	} {
+		if got := img.RGBAAt(p.x, p.y); got != p.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", p.x, p.y, got, p.want)
+		}
+	}
+}
+
+func TestNestedViewportsClip(t *testing.T) {
+	img, err := drawSvg(t, `<svg x="2" y="2" width="6" height="6">
+		<svg x="-2" y="2" width="6" height="6"><rect width="10" height="10" fill="red"/></svg>
+	</svg>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 4, red}, {5, 7, red},
+		{1, 4, white}, {6, 4, white}, {2, 3, white}, {5, 8, white},
+	} {
+		if got := img.RGBAAt(p.x, p.y); got != p.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", p.x, p.y, got, p.want)
+		}
+	}
+}
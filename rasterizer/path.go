@@ -0,0 +1,507 @@
+package rasterizer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Largest distance in the coordinate space of the document between a curve
+// and the line segments it gets flattened into.
+const flatness = 0.05
+
+// Path is a shape made of any number of subpaths of lines, curves and arcs.
+// It is built up the same way the d attribute describes it. All coordinates
+// are absolute.
+type Path struct {
+	transformable
+	Fill          string
+	Stroke        string
+	FillOpacity   float32
+	StrokeOpacity float32
+	FillRule      string // nonzero or evenodd.
+	commands      []pathCommand
+	contours      []contour // Flattened subpaths in the coordinate space of the document.
+}
+
+// pathCommand is an absolute moveto, lineto, quadratic or cubic bezier,
+// elliptical arc or closepath with the arguments in the order the d attribute
+// takes them.
+type pathCommand struct {
+	op   byte // One of M, L, Q, C, A and Z.
+	args [7]float32
+}
+
+// contour is a list of x, y pairs.
+type contour struct {
+	points []float32
+	closed bool
+}
+
+// NewPath returns an empty black path without a stroke.
+func NewPath() *Path {
+	return &Path{FillOpacity: 1, StrokeOpacity: 1}
+}
+
+// MoveTo starts a new subpath at (x, y).
+func (s *Path) MoveTo(x, y float32) {
+	s.commands = append(s.commands, pathCommand{op: 'M', args: [7]float32{x, y}})
+}
+
+func (s *Path) LineTo(x, y float32) {
+	s.commands = append(s.commands, pathCommand{op: 'L', args: [7]float32{x, y}})
+}
+
+// QuadTo adds a quadratic bezier curve with the control point (x1, y1).
+func (s *Path) QuadTo(x1, y1, x, y float32) {
+	s.commands = append(s.commands, pathCommand{op: 'Q', args: [7]float32{x1, y1, x, y}})
+}
+
+// CubicTo adds a cubic bezier curve with the control points (x1, y1) and
+// (x2, y2).
+func (s *Path) CubicTo(x1, y1, x2, y2, x, y float32) {
+	s.commands = append(s.commands, pathCommand{op: 'C', args: [7]float32{x1, y1, x2, y2, x, y}})
+}
+
+// ArcTo adds an elliptical arc with radii rx and ry whose x axis is rotated by
+// rotation degrees. Of the four arcs that fit, largeArc and sweep pick the
+// one that spans more than 180 degrees and the one drawn at positive angles.
+func (s *Path) ArcTo(rx, ry, rotation float32, largeArc, sweep bool, x, y float32) {
+	var large, positive float32
+	if largeArc {
+		large = 1
+	}
+	if sweep {
+		positive = 1
+	}
+	s.commands = append(s.commands, pathCommand{op: 'A',
+		args: [7]float32{rx, ry, rotation, large, positive, x, y}})
+}
+
+// Close draws a line back to the start of the current subpath.
+func (s *Path) Close() {
+	s.commands = append(s.commands, pathCommand{op: 'Z'})
+}
+
+func (s *Path) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+
+	s.contours = flattenPath(s.commands, userTolerance(s.transformMatrix))
+	for _, c := range s.contours {
+		transformPoints(c.points, s.transformMatrix)
+	}
+	return nil
+}
+
+// userTolerance is how precisely to flatten curves in user space so the error
+// is still below flatness once transformed by m.
+func userTolerance(m mgl.Mat3) float32 {
+	tolerance := float32(flatness)
+	if det := math.Abs(float64(m[0]*m[4] - m[1]*m[3])); det > 0 {
+		tolerance /= float32(math.Sqrt(det))
+	}
+	return tolerance
+}
+
+func (s *Path) rasterize(r *Rasterizer) error {
+	fill, ok, err := r.paint(s.Fill, "black", s.FillOpacity, s.transformMatrix, s.contours)
+	if err != nil {
+		return s.errorf("fill", err)
+	}
+	if ok {
+		r.fillContours(s.contours, s.FillRule == "evenodd", fill)
+	}
+
+	stroke, ok, err := r.paint(s.Stroke, "none", s.StrokeOpacity, s.transformMatrix, s.contours)
+	if err != nil {
+		return s.errorf("stroke", err)
+	}
+	if ok {
+		r.strokeContours(s.contours, stroke)
+	}
+	return nil
+}
+
+// flattenPath turns commands into contours made only of line segments, each
+// within tolerance of the curves they replace.
+func flattenPath(commands []pathCommand, tolerance float32) []contour {
+	var contours []contour
+	current := -1 // Index of the contour being drawn, if any.
+	var x, y, startX, startY float32
+
+	// Drawing after a closepath without a moveto continues from the start of
+	// the closed subpath.
+	begin := func() []float32 {
+		if current < 0 {
+			contours = append(contours, contour{points: []float32{startX, startY}})
+			current = len(contours) - 1
+		}
+		return contours[current].points
+	}
+
+	for _, cmd := range commands {
+		a := cmd.args
+		var points []float32
+		switch cmd.op {
+		case 'M':
+			startX, startY = a[0], a[1]
+			current = -1
+			points = begin()
+		case 'L':
+			points = append(begin(), a[0], a[1])
+		case 'Q':
+			points = appendQuad(begin(), x, y, a[0], a[1], a[2], a[3], tolerance)
+		case 'C':
+			points = appendCubic(begin(), x, y, a[0], a[1], a[2], a[3], a[4], a[5], tolerance)
+		case 'A':
+			points = appendArc(begin(), x, y, a[0], a[1], a[2],
+				a[3] != 0, a[4] != 0, a[5], a[6], tolerance)
+		case 'Z':
+			if current >= 0 {
+				contours[current].closed = true
+			}
+			current = -1
+			x, y = startX, startY
+			continue
+		}
+		contours[current].points = points
+		x, y = points[len(points)-2], points[len(points)-1]
+	}
+	return contours
+}
+
+// segments returns how many line segments a curve needs so that none of them
+// strays more than tolerance from it. dd is the largest second difference of
+// the control points and degree the degree of the curve, following Wang's
+// formula.
+func segments(dd float64, degree int, tolerance float32) int {
+	n := math.Ceil(math.Sqrt(float64(degree*(degree-1)) / 8 * dd / float64(tolerance)))
+	if n < 1 || math.IsNaN(n) {
+		return 1
+	}
+	return int(n)
+}
+
+func secondDifference(x0, y0, x1, y1, x2, y2 float32) float64 {
+	return math.Hypot(float64(x0-2*x1+x2), float64(y0-2*y1+y2))
+}
+
+func appendQuad(points []float32, x0, y0, x1, y1, x2, y2, tolerance float32) []float32 {
+	n := segments(secondDifference(x0, y0, x1, y1, x2, y2), 2, tolerance)
+	for i := 1; i <= n; i++ {
+		t := float32(i) / float32(n)
+		mt := 1 - t
+		points = append(points,
+			mt*mt*x0+2*mt*t*x1+t*t*x2,
+			mt*mt*y0+2*mt*t*y1+t*t*y2)
+	}
+	return points
+}
+
+func appendCubic(points []float32, x0, y0, x1, y1, x2, y2, x3, y3, tolerance float32) []float32 {
+	dd := math.Max(secondDifference(x0, y0, x1, y1, x2, y2), secondDifference(x1, y1, x2, y2, x3, y3))
+	n := segments(dd, 3, tolerance)
+	for i := 1; i <= n; i++ {
+		t := float32(i) / float32(n)
+		mt := 1 - t
+		points = append(points,
+			mt*mt*mt*x0+3*mt*mt*t*x1+3*mt*t*t*x2+t*t*t*x3,
+			mt*mt*mt*y0+3*mt*mt*t*y1+3*mt*t*t*y2+t*t*t*y3)
+	}
+	return points
+}
+
+// appendArc flattens an arc given the way the d attribute describes it by
+// first finding its center, as in the implementation notes of the SVG spec.
+func appendArc(points []float32, x1, y1, rx, ry, rotation float32, largeArc, sweep bool,
+	x2, y2, tolerance float32) []float32 {
+	if x1 == x2 && y1 == y2 {
+		return points
+	}
+	if rx == 0 || ry == 0 {
+		return append(points, x2, y2)
+	}
+
+	frx, fry := math.Abs(float64(rx)), math.Abs(float64(ry))
+	sin, cos := math.Sincos(float64(mgl.DegToRad(rotation)))
+
+	// The start point in a coordinate system centered between the end points
+	// and aligned with the axes of the ellipse.
+	dx, dy := float64(x1-x2)/2, float64(y1-y2)/2
+	x1p := cos*dx + sin*dy
+	y1p := -sin*dx + cos*dy
+
+	// Scale up radii too small to reach the end point.
+	if lambda := x1p*x1p/(frx*frx) + y1p*y1p/(fry*fry); lambda > 1 {
+		frx *= math.Sqrt(lambda)
+		fry *= math.Sqrt(lambda)
+	}
+
+	num := frx*frx*fry*fry - frx*frx*y1p*y1p - fry*fry*x1p*x1p
+	if num < 0 {
+		num = 0
+	}
+	coef := math.Sqrt(num / (frx*frx*y1p*y1p + fry*fry*x1p*x1p))
+	if largeArc == sweep {
+		coef = -coef
+	}
+	cxp := coef * frx * y1p / fry
+	cyp := -coef * fry * x1p / frx
+	cx := cos*cxp - sin*cyp + float64(x1+x2)/2
+	cy := sin*cxp + cos*cyp + float64(y1+y2)/2
+
+	theta := math.Atan2((y1p-cyp)/fry, (x1p-cxp)/frx)
+	delta := math.Atan2((-y1p-cyp)/fry, (-x1p-cxp)/frx) - theta
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	// Each segment spans an angle small enough to stay within tolerance of
+	// the larger radius.
+	step := 2 * math.Acos(math.Max(-1, 1-float64(tolerance)/math.Max(frx, fry)))
+	n := int(math.Ceil(math.Abs(delta) / step))
+	if n < 1 {
+		n = 1
+	}
+	for i := 1; i < n; i++ {
+		sinT, cosT := math.Sincos(theta + delta*float64(i)/float64(n))
+		points = append(points,
+			float32(cx+frx*cosT*cos-fry*sinT*sin),
+			float32(cy+frx*cosT*sin+fry*sinT*cos))
+	}
+	return append(points, x2, y2)
+}
+
+// pathScanner splits the d attribute into commands, numbers and flags.
+type pathScanner struct {
+	s string
+	i int
+}
+
+func (p *pathScanner) skipSeparators() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r', '\f', ',':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// rest describes the unread part of the data for error messages.
+func (p *pathScanner) rest() string {
+	rest := p.s[p.i:]
+	if rest == "" {
+		return "the end"
+	}
+	if len(rest) > 10 {
+		rest = rest[:10] + "..."
+	}
+	return strconv.Quote(rest)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// number reads a number, which ends as soon as what follows can't be part of
+// it so that "10-5" and "0.5.5" are both two numbers.
+func (p *pathScanner) number() (float32, error) {
+	p.skipSeparators()
+	s, start := p.s, p.i
+	i := start
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := false
+	for i < len(s) && isDigit(s[i]) {
+		i++
+		digits = true
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+			digits = true
+		}
+	}
+	if !digits {
+		return 0, fmt.Errorf("expected a number at %s", p.rest())
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+
+	f, err := strconv.ParseFloat(s[start:i], 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s[start:i])
+	}
+	p.i = i
+	return float32(f), nil
+}
+
+// flag reads an arc flag, which needs no separator after it.
+func (p *pathScanner) flag() (bool, error) {
+	p.skipSeparators()
+	if p.i < len(p.s) && (p.s[p.i] == '0' || p.s[p.i] == '1') {
+		p.i++
+		return p.s[p.i-1] == '1', nil
+	}
+	return false, fmt.Errorf("expected a flag at %s", p.rest())
+}
+
+// numbers reads len(dst) numbers.
+func (p *pathScanner) numbers(dst ...*float32) error {
+	for _, d := range dst {
+		f, err := p.number()
+		if err != nil {
+			return err
+		}
+		*d = f
+	}
+	return nil
+}
+
+// parsePathData parses the d attribute of a path into s.
+func parsePathData(d string, s *Path) error {
+	p := &pathScanner{s: d}
+
+	// The current point, the start of the current subpath and the control
+	// point S and T reflect.
+	var x, y, startX, startY, ctrlX, ctrlY float32
+	var cmd, last byte
+
+	for {
+		p.skipSeparators()
+		if p.i >= len(p.s) {
+			return nil
+		}
+
+		c := p.s[p.i]
+		switch {
+		case last == 0 && c != 'M' && c != 'm':
+			return fmt.Errorf("path data must start with a moveto, found %s", p.rest())
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			cmd = c
+			p.i++
+		case cmd == 'Z' || cmd == 'z':
+			return fmt.Errorf("unexpected number after closepath at %s", p.rest())
+		}
+
+		relative := cmd >= 'a'
+		var ox, oy float32 // Added to relative coordinates.
+		if relative {
+			ox, oy = x, y
+		}
+
+		// Control point of the previous curve, used by S and T.
+		reflectX, reflectY := x, y
+		upper := cmd &^ 0x20
+		if (upper == 'S' && (last == 'C' || last == 'S')) ||
+			(upper == 'T' && (last == 'Q' || last == 'T')) {
+			reflectX, reflectY = 2*x-ctrlX, 2*y-ctrlY
+		}
+
+		var a [7]float32
+		var err error
+		switch upper {
+		case 'M':
+			if err = p.numbers(&a[0], &a[1]); err != nil {
+				return err
+			}
+			x, y = a[0]+ox, a[1]+oy
+			startX, startY = x, y
+			s.MoveTo(x, y)
+			// Any more coordinates are implicit linetos.
+			cmd = 'L' | cmd&0x20
+		case 'L':
+			if err = p.numbers(&a[0], &a[1]); err != nil {
+				return err
+			}
+			x, y = a[0]+ox, a[1]+oy
+			s.LineTo(x, y)
+		case 'H':
+			if err = p.numbers(&a[0]); err != nil {
+				return err
+			}
+			x = a[0] + ox
+			s.LineTo(x, y)
+		case 'V':
+			if err = p.numbers(&a[0]); err != nil {
+				return err
+			}
+			y = a[0] + oy
+			s.LineTo(x, y)
+		case 'C':
+			if err = p.numbers(&a[0], &a[1], &a[2], &a[3], &a[4], &a[5]); err != nil {
+				return err
+			}
+			ctrlX, ctrlY = a[2]+ox, a[3]+oy
+			x, y = a[4]+ox, a[5]+oy
+			s.CubicTo(a[0]+ox, a[1]+oy, ctrlX, ctrlY, x, y)
+		case 'S':
+			if err = p.numbers(&a[0], &a[1], &a[2], &a[3]); err != nil {
+				return err
+			}
+			ctrlX, ctrlY = a[0]+ox, a[1]+oy
+			x, y = a[2]+ox, a[3]+oy
+			s.CubicTo(reflectX, reflectY, ctrlX, ctrlY, x, y)
+		case 'Q':
+			if err = p.numbers(&a[0], &a[1], &a[2], &a[3]); err != nil {
+				return err
+			}
+			ctrlX, ctrlY = a[0]+ox, a[1]+oy
+			x, y = a[2]+ox, a[3]+oy
+			s.QuadTo(ctrlX, ctrlY, x, y)
+		case 'T':
+			if err = p.numbers(&a[0], &a[1]); err != nil {
+				return err
+			}
+			ctrlX, ctrlY = reflectX, reflectY
+			x, y = a[0]+ox, a[1]+oy
+			s.QuadTo(ctrlX, ctrlY, x, y)
+		case 'A':
+			if err = p.numbers(&a[0], &a[1], &a[2]); err != nil {
+				return err
+			}
+			largeArc, err := p.flag()
+			if err != nil {
+				return err
+			}
+			sweep, err := p.flag()
+			if err != nil {
+				return err
+			}
+			if err = p.numbers(&a[5], &a[6]); err != nil {
+				return err
+			}
+			x, y = a[5]+ox, a[6]+oy
+			s.ArcTo(a[0], a[1], a[2], largeArc, sweep, x, y)
+		case 'Z':
+			x, y = startX, startY
+			s.Close()
+		default:
+			return fmt.Errorf("unknown path command %q", string(cmd))
+		}
+		last = upper
+	}
+}
@@ -0,0 +1,94 @@
+package rasterizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathData(t *testing.T) {
+	for _, test := range []struct {
+		d    string
+		want []pathCommand
+	}{
+		{"", nil},
+		{"M 1 2 L 3 4 Z", []pathCommand{
+			{op: 'M', args: [7]float32{1, 2}},
+			{op: 'L', args: [7]float32{3, 4}},
+			{op: 'Z'},
+		}},
+		// Extra coordinates after a moveto are linetos, relative ones
+		// are relative to the point before.
+		{"m1 1 2 2 3 3", []pathCommand{
+			{op: 'M', args: [7]float32{1, 1}},
+			{op: 'L', args: [7]float32{3, 3}},
+			{op: 'L', args: [7]float32{6, 6}},
+		}},
+		{"M10-5l5-5", []pathCommand{
+			{op: 'M', args: [7]float32{10, -5}},
+			{op: 'L', args: [7]float32{15, -10}},
+		}},
+		{"M1e-3,0.5.5.5", []pathCommand{
+			{op: 'M', args: [7]float32{0.001, 0.5}},
+			{op: 'L', args: [7]float32{0.5, 0.5}},
+		}},
+		{"M0 0H10V10h-5v-5", []pathCommand{
+			{op: 'M'},
+			{op: 'L', args: [7]float32{10, 0}},
+			{op: 'L', args: [7]float32{10, 10}},
+			{op: 'L', args: [7]float32{5, 10}},
+			{op: 'L', args: [7]float32{5, 5}},
+		}},
+		// Closing goes back to the start of the subpath.
+		{"M1 1L5 1zl1 1", []pathCommand{
+			{op: 'M', args: [7]float32{1, 1}},
+			{op: 'L', args: [7]float32{5, 1}},
+			{op: 'Z'},
+			{op: 'L', args: [7]float32{2, 2}},
+		}},
+		// S and T reflect the control point of the curve before them.
+		{"M0 0C1 1 2 1 3 0S5-1 6 0", []pathCommand{
+			{op: 'M'},
+			{op: 'C', args: [7]float32{1, 1, 2, 1, 3, 0}},
+			{op: 'C', args: [7]float32{4, -1, 5, -1, 6, 0}},
+		}},
+		{"M0 0Q1 1 2 0T4 0", []pathCommand{
+			{op: 'M'},
+			{op: 'Q', args: [7]float32{1, 1, 2, 0}},
+			{op: 'Q', args: [7]float32{3, -1, 4, 0}},
+		}},
+		// Without a curve before, S and T use the current point.
+		{"M1 1S2 2 3 3", []pathCommand{
+			{op: 'M', args: [7]float32{1, 1}},
+			{op: 'C', args: [7]float32{1, 1, 2, 2, 3, 3}},
+		}},
+		// Arc flags need no separators.
+		{"M0 0a5 5 30 1020 0", []pathCommand{
+			{op: 'M'},
+			{op: 'A', args: [7]float32{5, 5, 30, 1, 0, 20, 0}},
+		}},
+	} {
+		s := NewPath()
+		if err := parsePathData(test.d, s); err != nil {
+			t.Errorf("parsePathData(%q) returned error %v", test.d, err)
+			continue
+		}
+		if !reflect.DeepEqual(s.commands, test.want) {
+			t.Errorf("parsePathData(%q) = %v, want %v", test.d, s.commands, test.want)
+		}
+	}
+}
+
+func TestParsePathDataErrors(t *testing.T) {
+	for _, d := range []string{
+		"L 1 2",              // Doesn't start with a moveto.
+		"M 1",                // Missing a coordinate.
+		"M 1 2 X 3 4",        // Unknown command.
+		"M 0 0 Z 1 2",        // Numbers after a closepath.
+		"M0 0A5 5 0 2 0 1 1", // Not a flag.
+		"M 0 0 L 1 x",
+	} {
+		if err := parsePathData(d, NewPath()); err == nil {
+			t.Errorf("parsePathData(%q) returned no error", d)
+		}
+	}
+}
@@ -1,25 +1,19 @@
-package main
+// Package rasterizer renders SVG documents, or scenes built from Go, into
+// images.
+package rasterizer
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/xml"
+	"context"
 	"fmt"
 	"image"
-	"image/png"
-	"io/ioutil"
+	"image/draw"
 	"math"
-	"math/rand"
-	"net/http"
-	"strconv"
-	"strings"
-	"syscall/js"
+	"os"
+	"path"
+	"sort"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
-	"github.com/nicholasblaskey/dat-gui-go-wasm/datGUI"
-
-	"github.com/nicholasblaskey/svg-rasterizer/board"
-	"github.com/nicholasblaskey/svg-rasterizer/triangulate"
 )
 
 type Color struct {
@@ -29,44 +23,20 @@ type Color struct {
 	a float32
 }
 
-func maxOfThree(x, y, z float32) float32 {
-	return float32(math.Max(float64(x), math.Max(float64(y), float64(z))))
-}
-
-func minOfThree(x, y, z float32) float32 {
-	return float32(math.Min(float64(x), math.Min(float64(y), float64(z))))
-}
-
-func crossProduct(x1, y1, x2, y2 float32) float32 {
-	return x1*y2 - y1*x2
-}
-
-func parseColor(col string) Color {
-	if len(col) == 0 {
-		return Color{0, 0, 0, 1.0}
-	}
-
-	if len(col) == 6 { // Add in # if missing
-		col = "#" + col
-	}
-
-	r, _ := strconv.ParseInt(col[1:3], 16, 9)
-	g, _ := strconv.ParseInt(col[3:5], 16, 9)
-	b, _ := strconv.ParseInt(col[5:7], 16, 9)
-	a := 255
-
-	return Color{
-		float32(r) / 255.0,
-		float32(g) / 255.0,
-		float32(b) / 255.0,
-		float32(a) / 255.0,
-	}
-}
-
-type rasterizer struct {
-	board                *board.Board
+// Rasterizer parses an SVG document and renders it into an in-memory RGBA
+// buffer. It has no dependency on a browser so it can be used anywhere.
+type Rasterizer struct {
 	svg                  *Svg
+	loader               Loader
+	fonts                []*fontFace // Loaded by LoadFonts.
+	paintServers         map[string]PaintServer
+	elements             int // Elements in svg that get painted.
+	ctx                  context.Context
+	progress             func(Progress)
+	done                 Progress
 	pixels               []byte
+	clip                 *clipMask // Samples that may be painted, nil for all of them.
+	hidden               bool      // Visibility inherited by the element being painted.
 	widthPixels          int
 	heightPixels         int
 	width                float32
@@ -81,93 +51,169 @@ type rasterizer struct {
 	unscaledHeightPixels int
 	unscaledWidth        float32
 	unscaledHeight       float32
-	pointsToFill         []int
-	colorOfPointsToFill  []Color
-	canvas               js.Value
 	scale                float32
 }
 
-type Svg struct {
-	XMLName         xml.Name
-	Width           string     `xml:"width,attr"`
-	Height          string     `xml:"height,attr"`
-	ViewBox         string     `xml:"viewBox,attr"`
-	Rects           []Rect     `xml:"rect"`
-	Lines           []Line     `xml:"line"`
-	Polylines       []Polyline `xml:"polyline"`
-	Polygons        []Polygon  `xml:"polygon"`
-	Circles         []Circle   `xml:"circle"`
-	Groups          []*Svg     `xml:"g"`
-	Images          []*Image   `xml:"image"`
-	Transform       string     `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
+// New returns a rasterizer with no document loaded, a target scale of 1 and
+// super sampling turned off. Files are loaded from the working directory
+// until SetLoader is called.
+func New() *Rasterizer {
+	return &Rasterizer{
+		loader:     FSLoader(os.DirFS(".")),
+		scale:      1.0,
+		sampleRate: 1,
+	}
 }
 
-type Rect struct {
-	X               float32 `xml:"x,attr"`
-	Y               float32 `xml:"y,attr"`
-	Fill            string  `xml:"fill,attr"`
-	Stroke          string  `xml:"stroke,attr"`
-	Width           float32 `xml:"width,attr"`
-	Height          float32 `xml:"height,attr"`
-	StrokeOpacity   float32 `xml:"stroke-opacityt,attr"`
-	FillOpacity     float32 `xml:"fill-opacity,attr"`
-	Transform       string  `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
+// SetLoader sets where LoadSvg and the images of a document are loaded from.
+func (r *Rasterizer) SetLoader(loader Loader) {
+	r.loader = loader
 }
 
-func (s *Rect) rasterize(r *rasterizer) {
-	col := parseColor(s.Fill)
-	col.a = s.FillOpacity
-	if col.a == 0.0 {
-		col.a = 1.0
+// LoadSvg loads the named SVG document with the loader and makes it the one
+// drawn by Draw. Images the document links to resolve relative to its
+// location.
+func (r *Rasterizer) LoadSvg(name string) error {
+	data, err := r.loader.Load(name)
+	if err != nil {
+		return err
 	}
+	return r.setSvg(data, path.Dir(name))
+}
 
-	// If either width or height is 0 or 1 assume we have a single point.
-	transformed := r.transform([]float32{s.X, s.Y}, s.transformMatrix, false)
-	x, y := transformed[0], transformed[1]
-	if s.Width == 0.0 || s.Height == 0.0 || (s.Width == 1.0 && s.Height == 1.0) {
-		r.drawPixel(x, y, col)
-		return
+// SetSvg parses the given SVG document and makes it the one drawn by Draw.
+// Problems with the document are reported as a *ParseError.
+func (r *Rasterizer) SetSvg(data []byte) error {
+	return r.setSvg(data, ".")
+}
+
+func (r *Rasterizer) setSvg(data []byte, dir string) error {
+	// Parse the xml.
+	data = bytes.ReplaceAll(data, []byte("\r"), nil)
+	root, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+	svg, err := newDocument(root)
+	if err != nil {
+		return err
 	}
+	return r.setScene(svg, dir)
+}
+
+// SetScene makes a document built in Go, usually starting from NewDocument,
+// the one drawn by Draw. Changes made to the document afterwards are not seen
+// until it is set again. Problems with the elements in it, like a paint that
+// isn't a color or an element added to more than one group, are reported as a
+// *ParseError.
+func (r *Rasterizer) SetScene(svg *Svg) error {
+	return r.setScene(svg, ".")
+}
 
-	// Otherwise we have a full on rectangle.
-	// Draw rectangle border.
-	w := s.Width * r.scale
-	h := s.Height * r.scale
-	outlineCol := parseColor(s.Stroke)
-	col.a = s.StrokeOpacity
-	if col.a == 0.0 {
-		col.a = 1.0
+func (r *Rasterizer) setScene(svg *Svg, dir string) error {
+	if svg.Width < 0 || svg.Height < 0 {
+		return fmt.Errorf("negative document size %vx%v", svg.Width, svg.Height)
 	}
-	for i := float32(0); i < w; i++ {
-		r.drawPixel(x+i, y+1.0, outlineCol)
-		r.drawPixel(x+i, y+h-1, outlineCol)
+
+	// Resolve transforms, geometry and images once so Draw only has to
+	// rasterize.
+	c := &compiler{loader: r.loader, dir: dir, fonts: r.fonts,
+		compiled: map[Element]bool{svg: true}}
+	if svg.drawn() {
+		// The viewBox is fit into the size of the document, which is the
+		// size of the output at a target scale of 1.
+		m := mgl.Ident3()
+		if svg.ViewBox != nil {
+			var err error
+			m, err = viewBoxTransform(svg.ViewBox, svg.Width, svg.Height, svg.PreserveAspectRatio)
+			if err != nil {
+				return svg.errorf("preserveAspectRatio", err)
+			}
+		}
+		if err := svg.compile(c, m); err != nil {
+			return err
+		}
 	}
-	for i := float32(0); i < h; i++ {
-		r.drawPixel(x+0, y+i, outlineCol)
-		r.drawPixel(x+w-1, y+i, outlineCol)
+
+	r.svg = svg
+	r.elements = c.elements
+	r.paintServers = c.paintServers
+	r.unscaledWidth, r.unscaledHeight = svg.Width, svg.Height
+	r.unscaledWidthPixels, r.unscaledHeightPixels = int(svg.Width), int(svg.Height)
+
+	r.setScale(r.scale)
+
+	return nil
+}
+
+// SetTargetScale sets how large the output is relative to the size declared
+// by the document. The scale has to be a finite number above 0, anything else
+// is an error that leaves the scale as it was.
+func (r *Rasterizer) SetTargetScale(scale float32) error {
+	if !(scale > 0) || math.IsInf(float64(scale), 1) {
+		return fmt.Errorf("invalid target scale %v", scale)
 	}
+	r.setScale(scale)
+	return nil
+}
 
-	w *= float32(r.sampleRate)
-	h *= float32(r.sampleRate)
-	x *= float32(r.sampleRate)
-	y *= float32(r.sampleRate)
+func (r *Rasterizer) setScale(scale float32) {
+	r.scale = scale
 
-	// Draw inside of rectangle.
-	for x0 := x; x0 < x+w; x0++ {
-		for y0 := y; y0 < y+h; y0++ {
-			r.drawPoint(x0, y0, col)
-		}
+	// Rounded so that a scale worked out from a size in pixels gives back
+	// that size.
+	r.widthPixels = int(math.Round(float64(float32(r.unscaledWidthPixels) * scale)))
+	r.heightPixels = int(math.Round(float64(float32(r.unscaledHeightPixels) * scale)))
+	r.width = r.unscaledWidth * scale
+	r.height = r.unscaledHeight * scale
+}
+
+// SetSampleRate sets the super sample rate. Each output pixel is the average
+// of sampleRate x sampleRate samples.
+func (r *Rasterizer) SetSampleRate(sampleRate int) {
+	if sampleRate < 1 {
+		sampleRate = 1
 	}
+	r.sampleRate = sampleRate
+}
+
+func (r *Rasterizer) SampleRate() int {
+	return r.sampleRate
+}
+
+func (r *Rasterizer) TargetScale() float32 {
+	return r.scale
+}
 
+// Width returns the width in pixels of the image Draw produces.
+func (r *Rasterizer) Width() int {
+	return r.widthPixels
 }
 
+// Height returns the height in pixels of the image Draw produces.
+func (r *Rasterizer) Height() int {
+	return r.heightPixels
+}
+
+// UnscaledWidth returns the width in pixels of the document at a target
+// scale of 1.
+func (r *Rasterizer) UnscaledWidth() int {
+	return r.unscaledWidthPixels
+}
+
+// UnscaledHeight returns the height in pixels of the document at a target
+// scale of 1.
+func (r *Rasterizer) UnscaledHeight() int {
+	return r.unscaledHeightPixels
+}
+
+// blendColors draws col over a pixel of the buffer. Like image.RGBA the
+// buffer holds alpha premultiplied colors.
 func blendColors(col Color, red, g, b, a byte) (byte, byte, byte, byte) {
 	aPrimeA := float32(a) / 0xFF
-	aPrimeR := float32(red) / 0xFF * aPrimeA
-	aPrimeG := float32(g) / 0xFF * aPrimeA
-	aPrimeB := float32(b) / 0xFF * aPrimeA
+	aPrimeR := float32(red) / 0xFF
+	aPrimeG := float32(g) / 0xFF
+	aPrimeB := float32(b) / 0xFF
 
 	bPrimeR := col.r * col.a
 	bPrimeG := col.g * col.a
@@ -183,52 +229,39 @@ func blendColors(col Color, red, g, b, a byte) (byte, byte, byte, byte) {
 		byte(cPrimeB * 0xFF), byte(cPrimeA * 0xFF)
 }
 
-// This draws a point which will then be anti aliased.
-func (r *rasterizer) drawPoint(x, y float32, col Color) {
-	xCoord := int(x * float32(r.widthPixels) / r.width)
-	yCoord := r.heightPixels - int(y*float32(r.heightPixels)/r.height)
-
-	if xCoord < 0 || xCoord >= r.widthPixels ||
-		yCoord < 0 || yCoord >= r.heightPixels {
+func (r *Rasterizer) blendSample(xCoord, yCoord int, col Color) {
+	if r.clip != nil && !r.clip.contains(xCoord, yCoord) {
 		return
 	}
+	i := (xCoord + yCoord*r.widthPixels) * 4
 
-	red := r.pixels[(xCoord+yCoord*r.widthPixels)*4]
-	g := r.pixels[(xCoord+yCoord*r.widthPixels)*4+1]
-	b := r.pixels[(xCoord+yCoord*r.widthPixels)*4+2]
-	a := r.pixels[(xCoord+yCoord*r.widthPixels)*4+3]
+	red, g, b, a := blendColors(col, r.pixels[i], r.pixels[i+1], r.pixels[i+2], r.pixels[i+3])
 
-	red, g, b, a = blendColors(col, red, g, b, a)
-
-	r.pixels[(xCoord+yCoord*r.widthPixels)*4] = red
-	r.pixels[(xCoord+yCoord*r.widthPixels)*4+1] = g
-	r.pixels[(xCoord+yCoord*r.widthPixels)*4+2] = b
-	r.pixels[(xCoord+yCoord*r.widthPixels)*4+3] = a
+	r.pixels[i] = red
+	r.pixels[i+1] = g
+	r.pixels[i+2] = b
+	r.pixels[i+3] = a
 }
 
-// This draws a pixel which will be drawn into the final buffer after everything else
-// has been resolved.
-func (r *rasterizer) drawPixel(x, y float32, col Color) {
-	xCoord := int(x * float32(r.origWidthPixels) / r.origWidth)
-	yCoord := r.origHeightPixels - int(y*float32(r.origHeightPixels)/r.origHeight)
-
-	if xCoord < 0 || xCoord >= r.origWidthPixels ||
-		yCoord < 0 || yCoord >= r.origHeightPixels {
+// This draws a pixel of the final image which isn't anti aliased. Every
+// sample that makes up the pixel is filled so the pixel still gets painted in
+// document order.
+func (r *Rasterizer) drawPixel(x, y float32, p pattern) {
+	// Written so that coordinates that aren't numbers are left out too.
+	// Truncating puts anything above -1 on the first pixel.
+	fx := x * float32(r.origWidthPixels) / r.origWidth
+	fy := y * float32(r.origHeightPixels) / r.origHeight
+	if !(fx > -1 && fx < float32(r.origWidthPixels) && fy > -1 && fy < float32(r.origHeightPixels)) {
 		return
 	}
+	xCoord, yCoord := int(fx), int(fy)
 
-	r.pointsToFill = append(r.pointsToFill, (xCoord+yCoord*r.origWidthPixels)*4)
-	r.colorOfPointsToFill = append(r.colorOfPointsToFill, col)
-}
-
-type Line struct {
-	X1              float32 `xml:"x1,attr"`
-	Y1              float32 `xml:"y1,attr"`
-	X2              float32 `xml:"x2,attr"`
-	Y2              float32 `xml:"y2,attr"`
-	Fill            string  `xml:"stroke,attr"`
-	Transform       string  `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
+	col := p.at(x/r.scale, y/r.scale)
+	for i := 0; i < r.sampleRate; i++ {
+		for j := 0; j < r.sampleRate; j++ {
+			r.blendSample(xCoord*r.sampleRate+i, yCoord*r.sampleRate+j, col)
+		}
+	}
 }
 
 func round(x float32) float32 {
@@ -246,7 +279,14 @@ func rfpart(x float32) float32 {
 // Uses a single strain of Xiaolin since it seems to give the best results.
 // The two strains makes the colors look odd however revisit this after antialiasing.
 // Not sure if the resolution is just too low.
-func (r *rasterizer) drawLine(x0, y0, x1, y1 float32, col Color) {
+func (r *Rasterizer) drawLine(x0, y0, x1, y1 float32, col pattern) {
+	// A line off to infinity would never finish.
+	for _, v := range []float32{x0, y0, x1, y1} {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return
+		}
+	}
+
 	steep := math.Abs(float64(y1-y0)) > math.Abs(float64(x1-x0))
 	if steep {
 		x0, y0 = y0, x0
@@ -302,814 +342,378 @@ func (r *rasterizer) drawLine(x0, y0, x1, y1 float32, col Color) {
 	}
 }
 
-func (s *Line) rasterize(r *rasterizer) {
-	col := parseColor(s.Fill)
-
-	pointsFloat := r.transform([]float32{s.X1, s.Y1, s.X2, s.Y2}, s.transformMatrix, false)
-	r.drawLine(pointsFloat[0], pointsFloat[1], pointsFloat[2], pointsFloat[3], col)
+// sampleScale returns how much to scale the coordinate space of the document
+// by to get onto the sample grid while drawing. ok is false when there is no
+// grid to draw onto, as for a document with no size.
+func (r *Rasterizer) sampleScale() (sx, sy float32, ok bool) {
+	sx = r.scale * float32(r.sampleRate) * float32(r.widthPixels) / r.width
+	sy = r.scale * float32(r.sampleRate) * float32(r.heightPixels) / r.height
+	ok = sx > 0 && sy > 0 && !math.IsInf(float64(sx), 0) && !math.IsInf(float64(sy), 0)
+	return sx, sy, ok
 }
 
-type Polyline struct {
-	Stroke          string `xml:"stroke,attr"`
-	Points          string `xml:"points,attr"`
-	Transform       string `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
+// sampleSpan returns the samples from start up to but not including end,
+// clamped to the n samples of a row or column. Bounds that aren't numbers
+// give an empty span.
+func sampleSpan(start, end float64, n int) (int, int) {
+	if math.IsNaN(start) || math.IsNaN(end) {
+		return 0, 0
+	}
+	start = math.Min(math.Max(start, 0), float64(n))
+	end = math.Min(math.Max(end, 0), float64(n))
+	return int(start), int(end)
 }
 
-func (s *Polyline) rasterize(r *rasterizer) {
-	col := parseColor(s.Stroke)
-
-	pointsFloat := []float32{}
-	points := strings.Split(strings.Trim(s.Points, " \n\r\t"), " ")
-	for _, p := range points {
-		xy := strings.Split(strings.Trim(p, "\n\r\t "), ",")
-		x, err1 := strconv.ParseFloat(xy[0], 32)
-		y, err2 := strconv.ParseFloat(xy[1], 32)
-		if err1 != nil || err2 != nil {
-			if err1 != nil {
-				panic(err1)
+// fillContours paints the inside of contours, which are in the coordinate
+// space of the document and always treated as closed. A sample is inside when
+// the contours wind around it a nonzero number of times or, with evenOdd, an
+// odd number of times.
+func (r *Rasterizer) fillContours(contours []contour, evenOdd bool, p pattern) {
+	sx, sy, _ := r.sampleScale()
+	r.scanContours(contours, evenOdd, func(y, xStart, xEnd int) {
+		if col, ok := p.(Color); ok {
+			for x := xStart; x < xEnd; x++ {
+				r.blendSample(x, y, col)
 			}
-			panic(err2)
+			return
 		}
+		for x := xStart; x < xEnd; x++ {
+			r.blendSample(x, y, p.at(float32(x)/sx, float32(y)/sy))
+		}
+	})
+}
 
-		pointsFloat = append(pointsFloat, float32(x), float32(y))
+// scanContours calls span for every run of samples in row y from xStart up
+// to but not including xEnd that is inside contours, following the same rules
+// as fillContours.
+func (r *Rasterizer) scanContours(contours []contour, evenOdd bool, span func(y, xStart, xEnd int)) {
+	type edge struct {
+		x0, y0, x1, y1 float32 // y0 < y1
+		winding        int
 	}
 
-	pointsFloat = r.transform(pointsFloat, s.transformMatrix, false)
-	for i := 0; i < len(pointsFloat)/2-1; i++ {
-		r.drawLine(pointsFloat[i*2], pointsFloat[i*2+1],
-			pointsFloat[(i+1)*2], pointsFloat[(i+1)*2+1], col)
+	sx, sy, ok := r.sampleScale()
+	if !ok {
+		return
 	}
-}
-
-type Circle struct {
-	Cx              float32 `xml:"cx,attr"`
-	Cy              float32 `xml:"cy,attr"`
-	R               float32 `xml:"r,attr"`
-	Fill            string  `xml:'fill,attr"`
-	Transform       string  `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
-}
-
-func (s *Circle) rasterize(r *rasterizer) {
-	pointsFloat := r.transform([]float32{s.Cx, s.Cy}, s.transformMatrix, true)
-
-	cx := pointsFloat[0]
-	cy := pointsFloat[1]
-	radius := s.R * float32(r.sampleRate) * r.scale
 
-	col := parseColor(s.Fill)
-	minX, maxX := cx-radius, cx+radius
-	minY, maxY := cy-radius, cy+radius
-
-	for x := float32(int(minX)); x <= maxX; x++ {
-		for y := float32(int(minY)); y <= maxY; y++ {
-			dx, dy := cx-x, cy-y
-			if float32(math.Sqrt(float64(dx*dx+dy*dy))) <= radius {
-				r.drawPoint(x, y, col)
+	var edges []edge
+	minY, maxY := float32(math.Inf(1)), float32(math.Inf(-1))
+	for _, c := range contours {
+		n := len(c.points) / 2
+		for i := 0; i < n; i++ {
+			j := (i + 1) % n
+			e := edge{
+				x0: c.points[2*i] * sx, y0: c.points[2*i+1] * sy,
+				x1: c.points[2*j] * sx, y1: c.points[2*j+1] * sy,
+				winding: 1,
 			}
-		}
-	}
-}
-
-type Polygon struct {
-	Fill            string  `xml:"fill,attr"`
-	Stroke          string  `xml:"stroke,attr"`
-	Points          string  `xml:"points,attr"`
-	FillOpacity     float32 `xml:"fill-opacity,attr"`
-	StrokeOpacity   float32 `xml:"stroke-opacity,attr"`
-	Transform       string  `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
-}
-
-func parseTransform(trans string) mgl.Mat3 {
-	if strings.Contains(trans, "matrix") { // Matrix transformation case
-		trans = strings.TrimPrefix(trans, "matrix(")
-		trans = strings.Trim(trans, " )\n\t\r")
-
-		points := []float32{}
-		for _, s := range strings.Split(trans, ",") {
-			x, err := strconv.ParseFloat(s, 32)
-			if err != nil {
-				panic(err)
+			if e.y0 == e.y1 {
+				continue
+			}
+			if e.y0 > e.y1 {
+				e.x0, e.y0, e.x1, e.y1 = e.x1, e.y1, e.x0, e.y0
+				e.winding = -1
+			}
+			edges = append(edges, e)
+			if e.y0 < minY {
+				minY = e.y0
+			}
+			if e.y1 > maxY {
+				maxY = e.y1
 			}
-			points = append(points, float32(x))
 		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
 
-		mat := mgl.Ident3()
-		mat[0], mat[1] = points[0], points[1]
-		mat[3], mat[4] = points[2], points[3]
-		mat[6], mat[7] = points[4], points[5]
+	type crossing struct {
+		x       float32
+		winding int
+	}
+	var active []edge
+	var crossings []crossing
+	next := 0
 
-		return mat
-	} else if strings.Contains(trans, "translate") {
-		trans = strings.TrimPrefix(trans, "translate(")
-		trans = strings.Trim(trans, " )\n\t\r")
-		split := strings.Split(trans, " ")
+	yStart, yEnd := sampleSpan(math.Ceil(float64(minY)), math.Ceil(float64(maxY)), r.heightPixels)
+	for y := yStart; y < yEnd; y++ {
+		fy := float32(y)
 
-		x, err := strconv.ParseFloat(split[0], 32)
-		if err != nil {
-			panic(err)
+		// Edges cover the rows from their top up to but not including their
+		// bottom.
+		for next < len(edges) && edges[next].y0 <= fy {
+			active = append(active, edges[next])
+			next++
 		}
-		y, err := strconv.ParseFloat(split[1], 32)
-		if err != nil {
-			panic(err)
+		crossings = crossings[:0]
+		kept := active[:0]
+		for _, e := range active {
+			if e.y1 <= fy {
+				continue
+			}
+			kept = append(kept, e)
+			if e.y0 > fy {
+				continue
+			}
+			x := e.x0 + (fy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+			crossings = append(crossings, crossing{x, e.winding})
 		}
+		active = kept
+		sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+		winding := 0
+		for i := 0; i < len(crossings)-1; i++ {
+			winding += crossings[i].winding
+			inside := winding != 0
+			if evenOdd {
+				inside = winding%2 != 0
+			}
+			if !inside {
+				continue
+			}
 
-		return mgl.Translate2D(float32(x), float32(y))
-	} else if strings.Contains(trans, "scale(") {
-		trans = strings.TrimPrefix(trans, "scale(")
-		trans = strings.Trim(trans, " )\n\t\r")
-		split := strings.Split(trans, " ")
-
-		x, err := strconv.ParseFloat(split[0], 32)
-		if err != nil {
-			panic(err)
-		}
-		y, err := strconv.ParseFloat(split[1], 32)
-		if err != nil {
-			panic(err)
+			// Like rows, spans leave out a sample exactly on their right end
+			// so shapes sharing an edge don't both paint it.
+			xStart, xEnd := sampleSpan(math.Ceil(float64(crossings[i].x)),
+				math.Ceil(float64(crossings[i+1].x)), r.widthPixels)
+			if xStart < xEnd {
+				span(y, xStart, xEnd)
+			}
 		}
-
-		return mgl.Scale2D(float32(x), float32(y))
 	}
-	return mgl.Ident3()
 }
 
-func (r *rasterizer) transform(points []float32, trans mgl.Mat3, isAliased bool) []float32 {
-	for i := 0; i < len(points); i += 2 {
-		xyz := mgl.Vec3{points[i], points[i+1], 1.0}
-
-		transformed := trans.Mul3x1(xyz)
-
-		sampleRate := float32(r.sampleRate)
-		if !isAliased {
-			sampleRate = 1.0
-		}
+// clipMask is the samples that may be painted. It only covers the samples
+// within the bounds of the clip, so that a small clip stays cheap however large
+// the output is.
+type clipMask struct {
+	bounds image.Rectangle
+	inside []bool // Row by row within bounds.
+}
 
-		points[i] = transformed[0] * r.scale * sampleRate
-		points[i+1] = transformed[1] * r.scale * sampleRate
+func (c *clipMask) contains(x, y int) bool {
+	if !image.Pt(x, y).In(c.bounds) {
+		return false
 	}
-
-	return points
+	return c.inside[(y-c.bounds.Min.Y)*c.bounds.Dx()+x-c.bounds.Min.X]
 }
 
-func (r *rasterizer) pointsToTriangles(in string,
-	transformation mgl.Mat3) ([]*triangulate.Triangle, []float32) {
-
-	points := strings.Split(strings.Trim(in, " "), " ")
+// pushClip limits painting to the samples inside contours as well as the
+// current clip until popClip restores what pushClip returns.
+func (r *Rasterizer) pushClip(contours []contour) *clipMask {
+	type span struct{ y, xStart, xEnd int }
+	var spans []span
+	var bounds image.Rectangle
+	r.scanContours(contours, false, func(y, xStart, xEnd int) {
+		spans = append(spans, span{y, xStart, xEnd})
+		bounds = bounds.Union(image.Rect(xStart, y, xEnd, y+1))
+	})
 
-	pointsFloat := []float32{}
-	for _, p := range points {
-		xy := strings.Split(strings.Trim(p, "\n\r\t "), ",")
-		x, err1 := strconv.ParseFloat(xy[0], 32)
-		y, err2 := strconv.ParseFloat(xy[1], 32)
-		if err1 != nil || err2 != nil {
-			if err1 != nil {
-				panic(err1)
-			}
-			panic(err2)
+	previous := r.clip
+	clip := &clipMask{bounds: bounds, inside: make([]bool, bounds.Dx()*bounds.Dy())}
+	for _, s := range spans {
+		row := (s.y - bounds.Min.Y) * bounds.Dx()
+		for x := s.xStart; x < s.xEnd; x++ {
+			clip.inside[row+x-bounds.Min.X] = previous == nil || previous.contains(x, s.y)
 		}
-		pointsFloat = append(pointsFloat, float32(x), float32(y))
 	}
+	r.clip = clip
+	return previous
+}
 
-	pointsFloat = r.transform(pointsFloat, transformation, true)
+func (r *Rasterizer) popClip(previous *clipMask) {
+	r.clip = previous
+}
 
-	triangles := triangulate.Triangulate(pointsFloat)
-	for _, t := range triangles {
-		// Sort triangle such that y1 < y2 < y3
-		if t.Y1 > t.Y3 {
-			t.X1, t.Y1, t.X3, t.Y3 = t.X3, t.Y3, t.X1, t.Y1
-		}
-		if t.Y1 > t.Y2 {
-			t.X1, t.Y1, t.X2, t.Y2 = t.X2, t.Y2, t.X1, t.Y1
+// strokeContours outlines contours, which are in the coordinate space of the
+// document, with lines a pixel wide.
+func (r *Rasterizer) strokeContours(contours []contour, col pattern) {
+	for _, c := range contours {
+		points := r.scalePoints(c.points, false)
+		n := len(points) / 2
+		segments := n - 1
+		if c.closed {
+			segments = n
 		}
-		if t.Y2 > t.Y3 {
-			t.X2, t.Y2, t.X3, t.Y3 = t.X3, t.Y3, t.X2, t.Y2
+		for i := 0; i < segments; i++ {
+			j := (i + 1) % n
+			r.drawLine(points[2*i], points[2*i+1], points[2*j], points[2*j+1], col)
 		}
-
 	}
-	return triangles, pointsFloat
 }
 
-func (s *Polygon) rasterize(r *rasterizer) {
-	s.boundingBoxApproach(r)
+func downSampleBuffer(from []byte, sampleRate int, w, h int) []byte {
+	target := make([]byte, (w/sampleRate)*(h/sampleRate)*4)
+	sums := make([]int, w/sampleRate*4)
+	for y := 0; y < h/sampleRate; y++ {
+		downSampleRow(target, from, sums, sampleRate, w, y)
+	}
+	return target
 }
 
-func (s *Polygon) boundingBoxApproach(r *rasterizer) {
-	triangles, points := r.pointsToTriangles(s.Points, s.transformMatrix)
-
-	// Draw each triangle
-	col := parseColor(s.Fill)
-	col.a = s.FillOpacity
-	if col.a == 0.0 { // Handle missing opacity provided.
-		col.a = 1.0
+// downSampleRow averages the samples making up row y of the target. Sums is
+// scratch space for one row of the target.
+func downSampleRow(target, from []byte, sums []int, sampleRate, w, y int) {
+	targetW := w / sampleRate
+	for i := range sums {
+		sums[i] = 0
 	}
 
-	for _, t := range triangles {
-		minX := minOfThree(t.X1, t.X2, t.X3)
-		maxX := maxOfThree(t.X1, t.X2, t.X3)
-		minY := minOfThree(t.Y1, t.Y2, t.Y3)
-		maxY := maxOfThree(t.Y1, t.Y2, t.Y3)
+	for sy := y * sampleRate; sy < (y+1)*sampleRate; sy++ {
+		for x := 0; x < targetW*sampleRate; x++ {
+			i := x / sampleRate * 4
+			j := (x + sy*w) * 4
 
-		vsX1, vsY1 := t.X2-t.X1, t.Y2-t.Y1
-		vsX2, vsY2 := t.X3-t.X1, t.Y3-t.Y1
-
-		for x := float32(int(minX)); x <= maxX; x++ {
-			for y := float32(int(minY)); y <= maxY; y++ {
-				//for x := float32(minX); x <= maxX; x++ {
-				//	for y := float32(minY); y <= maxY; y++ {
-
-				qx, qy := x-t.X1, y-t.Y1
-
-				s := crossProduct(qx, qy, vsX2, vsY2) / crossProduct(vsX1, vsY1, vsX2, vsY2)
-				t := crossProduct(vsX1, vsY1, qx, qy) / crossProduct(vsX1, vsY1, vsX2, vsY2)
-
-				if s >= 0 && t >= 0 && s+t <= 1 {
-
-					r.drawPoint(x, y, col)
-				}
-			}
+			sums[i] += int(from[j])
+			sums[i+1] += int(from[j+1])
+			sums[i+2] += int(from[j+2])
+			sums[i+3] += int(from[j+3])
 		}
 	}
 
-	// Draw the outline if it exists.
-	if s.Stroke == "" {
-		return
+	row := target[y*targetW*4 : (y+1)*targetW*4]
+	scaleFactor := sampleRate * sampleRate
+	for i, sum := range sums {
+		row[i] = byte(sum / scaleFactor)
 	}
-	outlineCol := parseColor(s.Stroke)
-	outlineCol.a = s.StrokeOpacity
-	if outlineCol.a == 0.0 {
-		outlineCol.a = 1.0
-	}
-
-	for i := 0; i < len(points); i += 2 {
-		p1X, p1Y := points[i], points[i+1]
-		p2X, p2Y := points[(i+2)%len(points)], points[(i+3)%len(points)]
-		r.drawLine(p1X/float32(r.sampleRate), p1Y/float32(r.sampleRate),
-			p2X/float32(r.sampleRate), p2Y/float32(r.sampleRate), outlineCol)
-	}
-}
-
-type Image struct {
-	X               int    `xml:"x,attr"`
-	Y               int    `xml:"y,attr"`
-	Width           int    `xml:"width,attr"`
-	Height          int    `xml:"height,attr"`
-	Href            string `xml:"href,attr"` // Assume all images of base64 png encoded
-	mipMaps         []mip
-	Transform       string `xml:"transform,attr"`
-	transformMatrix mgl.Mat3
-	//imageSizeX int    // Width of image loaded
-	//imageSizeY int    // Height of image laoded
-}
-
-type mip struct {
-	w    int
-	h    int
-	data []byte
 }
 
-func (m *mip) At(x, y int) Color {
-	if x < 0 {
-		x = 0
-	}
-	if y < 0 {
-		y = 0
-	}
-	if x >= m.w {
-		x = m.w - 1
-	}
-	if y >= m.h {
-		y = m.h - 1
-	}
-
-	i := (x + y*m.w) * 4
-
-	return Color{float32(m.data[i]) / 0xFF,
-		float32(m.data[i+1]) / 0xFF,
-		float32(m.data[i+2]) / 0xFF,
-		float32(m.data[i+3]) / 0xFF}
+// Progress tells how far along a draw is.
+type Progress struct {
+	Elements      int // Elements painted so far.
+	TotalElements int
+	Rows          int // Rows of the output image resolved so far.
+	TotalRows     int
 }
 
-// Must be a power of two image
-func generateMipMaps(img image.Image) []mip {
-	bounds := img.Bounds()
-	w := bounds.Max.X - bounds.Min.X
-	h := bounds.Max.Y - bounds.Min.Y
-
-	// Get original mip.
-	mips := []mip{mip{w, h, make([]byte, w*h*4)}}
-	for x := 0; x < w; x++ {
-		for y := 0; y < h; y++ {
-			r, g, b, a := img.At(x, y).RGBA()
-
-			i := (x + y*w) * 4
-			mips[0].data[i] = byte(float32(r) / 0xFFFF * 0xFF)
-			mips[0].data[i+1] = byte(float32(g) / 0xFFFF * 0xFF)
-			mips[0].data[i+2] = byte(float32(b) / 0xFFFF * 0xFF)
-			mips[0].data[i+3] = byte(float32(a) / 0xFFFF * 0xFF)
-		}
-	}
-
-	for w > 1 && h > 1 {
-		buff := downSampleBuffer(mips[len(mips)-1].data, 2, w, h)
-
-		w /= 2
-		h /= 2
-
-		mips = append(mips, mip{w, h, buff})
-	}
-
-	return mips
+// SetProgressFunc sets a function that is called as a draw makes progress.
+// It is called from the goroutine drawing, so it should return quickly.
+func (r *Rasterizer) SetProgressFunc(f func(Progress)) {
+	r.progress = f
 }
 
-func (s *Image) rasterize(r *rasterizer) {
-	for x := int(float32(s.X) * r.scale); x < int(float32(s.X+s.Width)*r.scale); x++ {
-		for y := int(float32(s.Y) * r.scale); y < int(float32(s.Y+s.Height)*r.scale); y++ {
-			//col := s.sampleNearest(s.mipMaps[0], float32(x), float32(y))
-			col := s.sampleBilinear(s.mipMaps[0], float32(x)/r.scale, float32(y)/r.scale)
-
-			r.drawPixel(float32(x), float32(y), col)
-		}
+func (r *Rasterizer) reportProgress() {
+	if r.progress != nil {
+		r.progress(r.done)
 	}
 }
 
-func (s *Image) sampleNearest(img mip, x, y float32) Color {
-	x -= float32(s.X) + 0.5
-	y -= float32(s.Y) + 0.5
-
-	x = x / float32(s.Width) * float32(img.w)
-	y = y / float32(s.Height) * float32(img.h)
-
-	return img.At(int(x), int(y))
+// elementDone is called after painting each element that isn't a group.
+func (r *Rasterizer) elementDone() error {
+	r.done.Elements++
+	r.reportProgress()
+	return r.ctx.Err()
 }
 
-func blendColor(c0, c1 Color, amount float32) Color {
-	return Color{blend(c0.r, c1.r, amount), blend(c0.g, c1.g, amount),
-		blend(c0.b, c1.b, amount), blend(c0.a, c1.a, amount)}
+// Draw rasterizes the current document and returns the result. Pixels are
+// stored top to bottom like any other image.RGBA.
+func (r *Rasterizer) Draw() (*image.RGBA, error) {
+	return r.DrawContext(context.Background())
 }
 
-func blend(x0, x1, amount float32) float32 {
-	return x0*amount + x1*(1-amount)
+// DrawContext is Draw but gives up with the error of ctx once it is done.
+// Cancellation is checked between elements and between rows of the output.
+func (r *Rasterizer) DrawContext(ctx context.Context) (*image.RGBA, error) {
+	return r.render(ctx, true)
 }
 
-func (s *Image) sampleBilinear(img mip, x, y float32) Color {
-	x = x - float32(s.X) + 0.5
-	y = y - float32(s.Y) + 0.5
-	x = x / float32(s.Width) * float32(img.w)
-	y = y / float32(s.Height) * float32(img.h)
-
-	tt := x - float32(int(x+0.5)) + 0.5
-	st := y - float32(int(y+0.5)) + 0.5
-
-	f00 := img.At(int(x-0.5), int(y+0.5))
-	f01 := img.At(int(x-0.5), int(y-0.5))
-	f10 := img.At(int(x+0.5), int(y+0.5))
-	f11 := img.At(int(x+0.5), int(y-0.5))
-
-	c0 := blendColor(f00, f10, tt)
-	c1 := blendColor(f01, f11, tt)
-
-	c := blendColor(c0, c1, st)
-
-	return c
+// DrawInto rasterizes the current document scaled to fit inside rect, centered
+// within it, and composites the result over what dst already holds. The target
+// scale is left as it was.
+func (r *Rasterizer) DrawInto(dst draw.Image, rect image.Rectangle) error {
+	return r.DrawIntoContext(context.Background(), dst, rect)
 }
 
-func New(canvas js.Value, filePath string) (*rasterizer, error) {
-	r := &rasterizer{}
-	r.canvas = canvas
-	r.scale = 1.0
-
-	b, err := board.New(r.canvas)
-	if err != nil {
-		panic(err)
+// DrawIntoContext is DrawInto but gives up with the error of ctx once it is
+// done, leaving dst untouched.
+func (r *Rasterizer) DrawIntoContext(ctx context.Context, dst draw.Image, rect image.Rectangle) error {
+	if r.svg == nil || rect.Empty() ||
+		r.unscaledWidthPixels <= 0 || r.unscaledHeightPixels <= 0 {
+		return nil
 	}
-	r.board = b
 
-	r.SetSvg(filePath)
-	b.EnablePixelInspector(true)
-
-	return r, nil
-}
-
-func (r *rasterizer) SetSvg(filePath string) error {
-	// Get xml file and parse it.
-	fileString := getFile(filePath)
-	buf := bytes.NewBuffer([]byte(fileString))
-	dec := xml.NewDecoder(buf)
-	var svg Svg
-	if err := dec.Decode(&svg); err != nil {
-		return err
-	}
-	r.svg = &svg
-
-	// Calculate drawing info.
-	width, _ := strconv.ParseFloat(strings.Split(svg.Width, "px")[0], 64)
-	height, _ := strconv.ParseFloat(strings.Split(svg.Height, "px")[0], 64)
-
-	if svg.ViewBox != "" { // Does not have a viewbox
-		viewBox := strings.Split(svg.ViewBox, " ")
-		widthPixels, _ := strconv.ParseFloat(viewBox[2], 64)
-		heightPixels, _ := strconv.ParseFloat(viewBox[3], 64)
-		r.widthPixels = int(widthPixels)
-		r.heightPixels = int(heightPixels)
+	defer r.setScale(r.scale)
+	sx := float32(rect.Dx()) / float32(r.unscaledWidthPixels)
+	sy := float32(rect.Dy()) / float32(r.unscaledHeightPixels)
+	if sx < sy {
+		r.setScale(sx)
 	} else {
-		r.widthPixels, r.heightPixels = int(width), int(height)
+		r.setScale(sy)
 	}
 
-	r.width = float32(width)
-	r.height = float32(height)
-
-	// Update board.
-	r.board.SetWidthHeight(r.widthPixels, r.heightPixels)
-	r.board.ResetView()
-	r.canvas.Set("width", r.widthPixels)
-	r.canvas.Set("height", r.heightPixels)
-
-	// Calculate mip maps for all images.
-	loadImagesAndCreateMipMaps(r.svg)
-
-	r.sampleRate = 1
-
-	r.Draw()
-
-	r.unscaledWidth = r.width
-	r.unscaledHeight = r.height
-	r.unscaledWidthPixels = r.widthPixels
-	r.unscaledHeightPixels = r.heightPixels
-
-	return nil
-}
-
-func (r *rasterizer) SetTargetScale(scale float32) {
-	fmt.Println(scale)
-
-	r.scale = scale
-
-	r.widthPixels = int(float32(r.unscaledWidthPixels) * scale)
-	r.heightPixels = int(float32(r.unscaledHeightPixels) * scale)
-	r.width = r.unscaledWidth * scale
-	r.height = r.unscaledHeight * scale
-
-	r.board.SetWidthHeight(r.widthPixels, r.heightPixels)
-
-	r.Draw()
-}
-
-func loadImagesAndCreateMipMaps(curSvg *Svg) {
-	for _, imgSvg := range curSvg.Images {
-		// Load the image.
-		baseImage := strings.Split(imgSvg.Href, ",")[1] // Only works for data:image/png;base64,...
-		decoded, err := base64.StdEncoding.DecodeString(baseImage)
-		if err != nil { // Remove this.
-			panic(err)
-		}
-		reader := bytes.NewReader(decoded)
-
-		img, err := png.Decode(reader)
-		if err != nil {
-			panic(err)
-		}
-
-		imgSvg.mipMaps = generateMipMaps(img)
-	}
-
-	for _, g := range curSvg.Groups {
-		loadImagesAndCreateMipMaps(g)
+	img, err := r.render(ctx, false)
+	if err != nil {
+		return err
 	}
 
+	b := img.Bounds()
+	offset := rect.Min.Add(image.Pt((rect.Dx()-b.Dx())/2, (rect.Dy()-b.Dy())/2))
+	draw.Draw(dst, b.Add(offset), img, b.Min, draw.Over)
+	return nil
 }
 
-func downSampleBuffer(from []byte, sampleRate int, w, h int) []byte {
-	targetW := w / sampleRate
-	targetH := h / sampleRate
-	target := make([]byte, targetW*targetH*4)
-
-	scaleFactor := byte(sampleRate * sampleRate)
-	for x := 0; x < w; x++ {
-		for y := 0; y < h; y++ {
-			i := (x/sampleRate + y/sampleRate*targetW) * 4
-			j := (x + y*w) * 4
-
-			target[i] += from[j] / scaleFactor
-			target[i+1] += from[j+1] / scaleFactor
-			target[i+2] += from[j+2] / scaleFactor
-			target[i+3] += from[j+3] / scaleFactor
-		}
+// render rasterizes the current document onto either a white or a transparent
+// background.
+func (r *Rasterizer) render(ctx context.Context, opaque bool) (*image.RGBA, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return target
-}
+	r.ctx = ctx
+	r.done = Progress{TotalElements: r.elements, TotalRows: r.heightPixels}
 
-func (r *rasterizer) Draw() {
 	r.origWidthPixels, r.origHeightPixels = r.widthPixels, r.heightPixels
 	r.origWidth, r.origHeight = r.width, r.height
 
-	r.pointsToFill = []int{}
-	r.colorOfPointsToFill = []Color{}
-
 	r.widthPixels *= r.sampleRate
 	r.heightPixels *= r.sampleRate
 	r.width *= float32(r.sampleRate)
 	r.height *= float32(r.sampleRate)
 	r.pixels = make([]byte, 4*r.widthPixels*r.heightPixels)
-
-	for i := 0; i < len(r.pixels); i++ {
-		r.pixels[i] = 255
-	}
-
-	r.svg.transformMatrix = parseTransform(r.svg.Transform) // Can an SVG element have a transform??
-
-	r.svg.rasterize(r)
-
-	if r.sampleRate > 1 { // Anti aliasing
-		r.pixels = downSampleBuffer(r.pixels, r.sampleRate, r.widthPixels, r.heightPixels)
-	}
-
-	// Fill points/lines that we aren't antialiaisng on.
-	for i, point := range r.pointsToFill {
-		red := r.pixels[point]
-		g := r.pixels[point+1]
-		b := r.pixels[point+2]
-		a := r.pixels[point+3]
-
-		red, g, b, a = blendColors(r.colorOfPointsToFill[i], red, g, b, a)
-
-		r.pixels[point] = red
-		r.pixels[point+1] = g
-		r.pixels[point+2] = b
-		r.pixels[point+3] = a
-	}
-
-	r.board.SetPixels(r.pixels)
-
-	r.widthPixels, r.heightPixels = r.origWidthPixels, r.origHeightPixels
-	r.width, r.height = r.origWidth, r.origHeight
-}
-
-func (s *Svg) rasterize(r *rasterizer) {
-	for _, rect := range s.Rects {
-		rect.transformMatrix = parseTransform(rect.Transform)
-		rect.transformMatrix = s.transformMatrix.Mul3(rect.transformMatrix)
-
-		rect.rasterize(r)
-	}
-
-	for _, polyline := range s.Polylines {
-		polyline.transformMatrix = parseTransform(polyline.Transform)
-		polyline.transformMatrix = s.transformMatrix.Mul3(polyline.transformMatrix)
-
-		polyline.rasterize(r)
-	}
-
-	for _, line := range s.Lines {
-		line.transformMatrix = parseTransform(line.Transform)
-		line.transformMatrix = s.transformMatrix.Mul3(line.transformMatrix)
-
-		line.rasterize(r)
-	}
-
-	for _, circle := range s.Circles {
-		circle.transformMatrix = parseTransform(circle.Transform)
-		circle.transformMatrix = s.transformMatrix.Mul3(circle.transformMatrix)
-
-		circle.rasterize(r)
-	}
-
-	for _, polygon := range s.Polygons {
-		polygon.transformMatrix = parseTransform(polygon.Transform)
-		polygon.transformMatrix = s.transformMatrix.Mul3(polygon.transformMatrix)
-
-		polygon.rasterize(r)
-	}
-
-	for _, group := range s.Groups {
-		group.transformMatrix = parseTransform(group.Transform)
-		group.transformMatrix = s.transformMatrix.Mul3(group.transformMatrix)
-
-		group.rasterize(r)
-	}
-
-	for _, image := range s.Images {
-		image.transformMatrix = parseTransform(image.Transform)
-		image.transformMatrix = s.transformMatrix.Mul3(image.transformMatrix)
-
-		image.rasterize(r)
-	}
-}
-
-func getUrl(filePath string) string {
-	loc := js.Global().Get("location")
-	url := loc.Get("protocol").String() + "//" +
-		loc.Get("hostname").String() + ":" +
-		loc.Get("port").String()
-
-	return url + filePath
-}
-
-func getFile(url string) string {
-	resp, err := http.Get(url)
-	if err != nil {
-		panic(err)
-	}
-
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
-	}
-	s := string(b)
-	return strings.ReplaceAll(s, "\r", "")
-}
-
-type testType struct {
-	X   int
-	Y   bool
-	Z   float32
-	W   string
-	Fun func()
-}
-
-func addSvgToGUI(gui *datGUI.GUI, path string, r *rasterizer, onSvgLoad func()) {
-	obj := testType{Fun: func() {
-		go func() {
-			r.SetSvg(path)
-			onSvgLoad()
-		}()
-	}}
-
-	split := strings.Split(path, "/")
-	name := strings.TrimSuffix(split[len(split)-1], ".svg")
-	funController := gui.Add(&obj, "Fun").Name(name)
-
-	svgIcon := js.Global().Get("document").Call("createElement", "img")
-	svgIcon.Set("background-color", "white")
-	svgIcon.Get("style").Set("background-color", "white")
-	svgIcon.Get("style").Set("float", "right")
-
-	height := 75
-	svgIcon.Set("src", path)
-	svgIcon.Set("height", height)
-	funController.JSController.Get("__li").Get("style").Set("height", height)
-	funController.JSController.Get("domElement").Get("parentElement").Call("appendChild", svgIcon)
-}
-
-func createSvgFolders(gui *datGUI.GUI, r *rasterizer, onSvgLoad func()) {
-	style := js.Global().Get("document").Call("createElement", "style")
-	style.Set("innerHTML", `
-    ul.closed > :not(li.title) {
-		display: none;
-    }`)
-	js.Global().Get("document").Get("head").Call("appendChild", style)
-
-	folderNames := []string{"basic", "alpha", "illustration", "hardcore"}
-	svgFiles := [][]string{
-		[]string{"test1", "test2", "test3", "test4", "test5", "test6", "test7"},
-		[]string{"01_prism", "02_cube", "03_buckyball", "04_scotty", "05_sphere"},
-		[]string{"01_sketchpad", "02_hexes", "03_circle", "04_sun", "05_lion",
-			"06_sphere", "07_lines", "08_monkeytree", "09_kochcurve"},
-		[]string{"01_degenerate_square1", "02_degenerate_square2"},
-	}
-
-	svgImagesGUI := gui.AddFolder("svg images")
-	svgImagesGUI.Open()
-	for i, folder := range folderNames {
-		folderGUI := svgImagesGUI.AddFolder(folder)
-
-		//if folder == "alpha" {
-		if folder == "illustration" {
-			folderGUI.Open()
+	r.clip = nil
+	r.hidden = false
+
+	// Start from white, doubling the filled part each copy.
+	if opaque && len(r.pixels) > 0 {
+		r.pixels[0] = 255
+		for filled := 1; filled < len(r.pixels); filled *= 2 {
+			copy(r.pixels[filled:], r.pixels[:filled])
 		}
-		for _, svgFile := range svgFiles[i] {
-			addSvgToGUI(folderGUI, getUrl("/svg/"+folder+"/"+svgFile+".svg"), r, onSvgLoad)
-		}
-	}
-}
-
-type guiValues struct {
-	SuperSampleRate         int
-	TargetScale             float32
-	CanvasScale             float32
-	WidthHeightPixelInspect int
-	PixelInspectorOn        bool
-	PixelInspectorScale     float32
-}
-
-func createGui(r *rasterizer) {
-	gui := datGUI.New()
-	gui.JSGUI.Set("width", 300)
-
-	guiVals := guiValues{
-		SuperSampleRate:         1,
-		TargetScale:             100,
-		CanvasScale:             100,
-		PixelInspectorOn:        true,
-		PixelInspectorScale:     30,
-		WidthHeightPixelInspect: 25,
 	}
 
-	// Pixel inspector GUI
-	pixelGui := gui.AddFolder("Pixel inspector")
-	pixelGui.Open()
-	pixelGui.Add(&guiVals, "PixelInspectorOn").Name("Inspector on?").OnChange(func() {
-		r.board.EnablePixelInspector(guiVals.PixelInspectorOn)
-	})
-	pixelGui.Add(&guiVals, "PixelInspectorScale").Min(5).Max(
-		80).Name("Inspector size").OnChange(func() {
-		r.board.SetInspectorSize(guiVals.PixelInspectorScale / 100.0)
-	})
-	pixelGui.Add(&guiVals, "WidthHeightPixelInspect").Min(1).Max(
-		100).Name("Width Height (px)").OnChange(func() {
-		r.board.SetWidthHeightPixelInspector(guiVals.WidthHeightPixelInspect)
-	})
+	defer func() {
+		r.widthPixels, r.heightPixels = r.origWidthPixels, r.origHeightPixels
+		r.width, r.height = r.origWidth, r.origHeight
+	}()
 
-	// Rasterizer GUI
-	rasterizerGui := gui.AddFolder("Rasterizer settings")
-	rasterizerGui.Open()
-	rasterizerGui.Add(&guiVals,
-		"SuperSampleRate").Min(1).Max(8).Name("Super sample rate").OnChange(func() {
-		if r.sampleRate == guiVals.SuperSampleRate {
-			return
+	if r.svg != nil && r.svg.drawn() {
+		r.hidden = r.svg.Visibility == "hidden" || r.svg.Visibility == "collapse"
+		if err := r.svg.rasterize(r); err != nil {
+			return nil, err
 		}
-
-		r.sampleRate = guiVals.SuperSampleRate
-		r.Draw()
-	})
-
-	setCanvasScale := func() {
-		scaleVal := (guiVals.CanvasScale / 100.0) * (guiVals.TargetScale / 100.0)
-		r.canvas.Set("width", scaleVal*float32(r.unscaledWidthPixels))
-		r.canvas.Set("height", scaleVal*float32(r.unscaledHeightPixels))
-		r.board.Draw()
 	}
-	targetScaleController := rasterizerGui.Add(&guiVals,
-		"TargetScale").Min(1).Max(200).Step(
-		0.1).Name("Target scale %").OnChange(func() {
-		r.SetTargetScale(guiVals.TargetScale / 100.0)
-
-		setCanvasScale()
-	})
-	canvasScaleController := rasterizerGui.Add(&guiVals,
-		"CanvasScale").Min(1).Max(500).Step(
-		0.1).Name("Canvas scale %").OnChange(func() {
-		setCanvasScale()
-	})
-
-	onSvgLoad := func() {
-		canvasScaleController.SetValue(100)
-		targetScaleController.SetValue(100)
-	}
-
-	// SVG options GUI
-	createSvgFolders(gui, r, onSvgLoad)
-}
 
-func main() {
-	document := js.Global().Get("document")
-	canvas := document.Call("getElementById", "webgl")
-	canvas.Get("style").Set("border-style", "solid")
-
-	//r, err := New(canvas, "/svg/basic/test1.svg")
-	//r, err := New(canvas, "/svg/basic/test2.svg")
-	//r, err := New(canvas, "/svg/basic/test3.svg")
-	//r, err := New(canvas, "/svg/basic/test4.svg")
-	//r, err := New(canvas, "/svg/basic/test5.svg")
-	//r, err := New(canvas, "/svg/basic/test6.svg")
-	//r, err := New(canvas, "/svg/basic/test7.svg")
-
-	//r, err := New(canvas, "/svg/alpha/01_prism.svg")
-	//r, err := New(canvas, "/svg/alpha/02_cube.svg")
-	//r, err := New(canvas, "/svg/alpha/03_buckyball.svg")
-	//r, err := New(canvas, "/svg/alpha/04_scotty.svg")
-	//r, err := New(canvas, "/svg/alpha/05_sphere.svg")
-
-	//r, err := New(canvas, getUrl("/svg/illustration/01_sketchpad.svg"))
-	//r, err := New(canvas, "/svg/illustration/02_hexes.svg")
-	//r, err := New(canvas, "/svg/illustration/03_circle.svg")
-	//r, err := New(canvas, "/svg/illustration/04_sun.svg")
-	r, err := New(canvas, "/svg/illustration/05_lion.svg")
-	//r, err := New(canvas, "/svg/illustration/06_sphere.svg")
-	//r, err := New(canvas, "/svg/illustration/07_lines.svg")
-	//r, err := New(canvas, "/svg/illustration/08_monkeytree.svg")
-	//r, err := New(canvas, "/svg/illustration/09_kochcurve.svg")
-
-	//r, err := New(canvas, "/svg/hardcore/01_degenerate_square1.svg")
-	//r, err := New(canvas, "/svg/hardcore/02_degenerate_square2.svg")
-
-	//r.SetSvg("/svg/illustration/01_sketchpad.svg")
-
-	createGui(r)
-
-	if err != nil {
-		panic(err)
+	if r.sampleRate > 1 { // Anti aliasing
+		target := make([]byte, 4*r.origWidthPixels*r.origHeightPixels)
+		sums := make([]int, 4*r.origWidthPixels)
+		for y := 0; y < r.origHeightPixels; y++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			downSampleRow(target, r.pixels, sums, r.sampleRate, r.widthPixels, y)
+			r.done.Rows++
+			r.reportProgress()
+		}
+		r.pixels = target
+	} else {
+		r.done.Rows = r.origHeightPixels
+		r.reportProgress()
 	}
 
-	_ = r
-	/*
-		canvas.Set("height", 900)
-		canvas.Set("width", 900)
-	*/
-
-	fmt.Println("starting", rand.Int31n(256))
-
-	<-make(chan bool) // Prevent program from exiting
+	return &image.RGBA{
+		Pix:    r.pixels,
+		Stride: 4 * r.origWidthPixels,
+		Rect:   image.Rect(0, 0, r.origWidthPixels, r.origHeightPixels),
+	}, nil
 }
@@ -0,0 +1,117 @@
+package rasterizer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSetTargetScaleInvalid(t *testing.T) {
+	r := New()
+	if err := r.SetScene(NewDocument(10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	for _, scale := range []float32{0, -1, float32(math.NaN()), float32(math.Inf(1))} {
+		if err := r.SetTargetScale(scale); err == nil {
+			t.Errorf("SetTargetScale(%v) returned no error", scale)
+		}
+	}
+	if r.TargetScale() != 1 || r.Width() != 10 || r.Height() != 10 {
+		t.Errorf("scale = %v, size = %dx%d after invalid scales, want 1 and 10x10", r.TargetScale(), r.Width(), r.Height())
+	}
+}
+
+func TestSetTargetScaleRounds(t *testing.T) {
+	for _, test := range []struct {
+		size, want int
+	}{{97, 100}, {99, 100}, {53, 500}, {500, 53}} {
+		r := New()
+		if err := r.SetScene(NewDocument(float32(test.size), 1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SetTargetScale(float32(test.want) / float32(test.size)); err != nil {
+			t.Fatal(err)
+		}
+		if r.Width() != test.want {
+			t.Errorf("width of %d scaled to %d = %d", test.size, test.want, r.Width())
+		}
+	}
+}
+
+func newProgressScene(t *testing.T) *Rasterizer {
+	t.Helper()
+	doc := NewDocument(4, 4)
+	doc.Add(NewRect(0, 0, 1, 1), NewGroup(NewRect(1, 1, 1, 1), NewCircle(2, 2, 1)), NewLine(0, 0, 4, 4))
+	r := New()
+	r.SetSampleRate(2)
+	if err := r.SetScene(doc); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDrawProgress(t *testing.T) {
+	r := newProgressScene(t)
+	var last Progress
+	calls := 0
+	r.SetProgressFunc(func(p Progress) {
+		if p.Elements < last.Elements || p.Rows < last.Rows {
+			t.Errorf("progress went from %+v back to %+v", last, p)
+		}
+		last = p
+		calls++
+	})
+	if _, err := r.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	want := Progress{Elements: 4, TotalElements: 4, Rows: 4, TotalRows: 4}
+	if last != want {
+		t.Errorf("last progress = %+v, want %+v", last, want)
+	}
+	if calls != 8 {
+		t.Errorf("progress reported %d times, want once per element and row", calls)
+	}
+}
+
+func TestDrawCancel(t *testing.T) {
+	r := newProgressScene(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last Progress
+	r.SetProgressFunc(func(p Progress) {
+		last = p
+		if p.Elements == 2 {
+			cancel()
+		}
+	})
+	img, err := r.DrawContext(ctx)
+	if !errors.Is(err, context.Canceled) || img != nil {
+		t.Errorf("DrawContext = %v, %v, want context.Canceled", img, err)
+	}
+	if last.Elements != 2 || last.Rows != 0 {
+		t.Errorf("progress = %+v, want the draw to stop after the second element", last)
+	}
+
+	// An already cancelled draw doesn't start, and a new context draws again.
+	if _, err := r.DrawContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("DrawContext after cancelling = %v, want context.Canceled", err)
+	}
+	if _, err := r.Draw(); err != nil {
+		t.Errorf("Draw after cancelling = %v", err)
+	}
+}
+
+func TestDrawCancelWhileDownSampling(t *testing.T) {
+	r := newProgressScene(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.SetProgressFunc(func(p Progress) {
+		if p.Rows == 1 {
+			cancel()
+		}
+	})
+	if _, err := r.DrawContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("DrawContext = %v, want context.Canceled", err)
+	}
+}
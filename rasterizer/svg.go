@@ -0,0 +1,666 @@
+package rasterizer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Element is a drawable part of a document. Elements come from parsing a
+// document with SetSvg or from the New functions of this package. An element
+// is compiled once when the document is set, which resolves its transform and
+// prepares whatever geometry it can ahead of time, and is then rasterized on
+// every draw.
+type Element interface {
+	compile(c *compiler, parent mgl.Mat3) error
+	rasterize(r *Rasterizer) error
+	base() *transformable
+}
+
+// transformable is embedded in every element. Transform is the transform of
+// the element relative to its parent, the zero matrix standing in for the
+// identity. transformMatrix is the matrix it resolves to once combined with the
+// transforms of all the ancestors of the element.
+//
+// Display and Visibility decide whether the element is drawn at all. A
+// Display of "none" leaves out the element along with everything in it. A
+// Visibility of "hidden" or "collapse" only hides the element itself, and
+// is inherited by the elements in it unless they are "visible" again.
+type transformable struct {
+	source
+	Transform       mgl.Mat3
+	Display         string
+	Visibility      string // Empty to inherit.
+	transformMatrix mgl.Mat3
+}
+
+func (t *transformable) base() *transformable {
+	return t
+}
+
+func (t *transformable) compile(c *compiler, parent mgl.Mat3) error {
+	transform := t.Transform
+	if transform == (mgl.Mat3{}) {
+		transform = mgl.Ident3()
+	}
+	t.transformMatrix = parent.Mul3(transform)
+	return nil
+}
+
+// Svg is either the root of a document or a group within it. Children are
+// kept in document order which is the order they are painted in. Width,
+// Height, ViewBox and PreserveAspectRatio only apply to the root and to a
+// Viewport.
+type Svg struct {
+	transformable
+	Width               float32
+	Height              float32
+	ViewBox             []float32 // min-x, min-y, width and height or nil.
+	PreserveAspectRatio string    // How the ViewBox is fit, xMidYMid meet when empty.
+	children            []Element
+
+	paintServers map[string]PaintServer // Set by Define.
+}
+
+// NewDocument returns an empty document of the given size in user units.
+func NewDocument(width, height float32) *Svg {
+	return &Svg{Width: width, Height: height}
+}
+
+// drawn reports whether anything of the document shows. Like display none,
+// an empty size or viewBox hides all of it.
+func (s *Svg) drawn() bool {
+	return s.Display != "none" && s.Width > 0 && s.Height > 0 &&
+		(s.ViewBox == nil || s.ViewBox[2] > 0 && s.ViewBox[3] > 0)
+}
+
+// NewGroup returns a group holding children. Its Transform applies to all of
+// them.
+func NewGroup(children ...Element) *Svg {
+	return &Svg{children: children}
+}
+
+// Add appends children to the document or group. They are painted after the
+// elements already in it. An element can only be in one group at a time,
+// SetScene rejects a document where it is in more; build a copy for every
+// place it is drawn instead.
+func (s *Svg) Add(children ...Element) {
+	s.children = append(s.children, children...)
+}
+
+type Rect struct {
+	transformable
+	X             float32
+	Y             float32
+	Fill          string
+	Stroke        string
+	Width         float32
+	Height        float32
+	Rx            float32 // Corner radii, clamped to half of the width and height.
+	Ry            float32
+	StrokeOpacity float32
+	FillOpacity   float32
+	outline       []contour
+}
+
+// NewRect returns an unstroked black rectangle.
+func NewRect(x, y, width, height float32) *Rect {
+	return &Rect{X: x, Y: y, Width: width, Height: height,
+		FillOpacity: 1, StrokeOpacity: 1}
+}
+
+func (s *Rect) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+
+	s.outline = nil
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil
+	}
+
+	rx := float32(math.Min(float64(s.Rx), float64(s.Width/2)))
+	ry := float32(math.Min(float64(s.Ry), float64(s.Height/2)))
+	x0, y0, x1, y1 := s.X, s.Y, s.X+s.Width, s.Y+s.Height
+	if rx <= 0 || ry <= 0 {
+		s.outline = []contour{{
+			points: []float32{x0, y0, x1, y0, x1, y1, x0, y1},
+			closed: true,
+		}}
+	} else {
+		// Straight edges joined by quarter arcs, clockwise from the top left.
+		s.outline = flattenPath([]pathCommand{
+			{op: 'M', args: [7]float32{x0 + rx, y0}},
+			{op: 'L', args: [7]float32{x1 - rx, y0}},
+			{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, x1, y0 + ry}},
+			{op: 'L', args: [7]float32{x1, y1 - ry}},
+			{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, x1 - rx, y1}},
+			{op: 'L', args: [7]float32{x0 + rx, y1}},
+			{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, x0, y1 - ry}},
+			{op: 'L', args: [7]float32{x0, y0 + ry}},
+			{op: 'A', args: [7]float32{rx, ry, 0, 0, 1, x0 + rx, y0}},
+			{op: 'Z'},
+		}, userTolerance(s.transformMatrix))
+	}
+	for _, c := range s.outline {
+		transformPoints(c.points, s.transformMatrix)
+	}
+	return nil
+}
+
+func (s *Rect) rasterize(r *Rasterizer) error {
+	fill, ok, err := r.paint(s.Fill, "black", s.FillOpacity, s.transformMatrix, s.outline)
+	if err != nil {
+		return s.errorf("fill", err)
+	}
+	if ok {
+		r.fillContours(s.outline, false, fill)
+	}
+
+	stroke, ok, err := r.paint(s.Stroke, "none", s.StrokeOpacity, s.transformMatrix, s.outline)
+	if err != nil {
+		return s.errorf("stroke", err)
+	}
+	if ok {
+		r.strokeContours(s.outline, stroke)
+	}
+	return nil
+}
+
+type Line struct {
+	transformable
+	X1     float32
+	Y1     float32
+	X2     float32
+	Y2     float32
+	Stroke string
+}
+
+// NewLine returns a black line from (x1, y1) to (x2, y2).
+func NewLine(x1, y1, x2, y2 float32) *Line {
+	return &Line{X1: x1, Y1: y1, X2: x2, Y2: y2, Stroke: "black"}
+}
+
+func (s *Line) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	return s.checkPaint("stroke", s.Stroke)
+}
+
+func (s *Line) rasterize(r *Rasterizer) error {
+	points := transformPoints([]float32{s.X1, s.Y1, s.X2, s.Y2}, s.transformMatrix)
+	col, ok, err := r.paint(s.Stroke, "none", 1, s.transformMatrix, []contour{{points: points}})
+	if err != nil {
+		return s.errorf("stroke", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	pointsFloat := r.scalePoints(points, false)
+	r.drawLine(pointsFloat[0], pointsFloat[1], pointsFloat[2], pointsFloat[3], col)
+	return nil
+}
+
+type Polyline struct {
+	transformable
+	Fill          string
+	Stroke        string
+	Points        []float32 // x, y pairs.
+	FillOpacity   float32
+	StrokeOpacity float32
+	FillRule      string    // nonzero or evenodd.
+	points        []float32 // Points in the coordinate space of the document.
+}
+
+// NewPolyline returns an unfilled black polyline through points, given as
+// x, y pairs.
+func NewPolyline(points ...float32) *Polyline {
+	return &Polyline{Points: points, Fill: "none", Stroke: "#000000",
+		FillOpacity: 1, StrokeOpacity: 1}
+}
+
+func (s *Polyline) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+	if len(s.Points)%2 != 0 {
+		return s.errorf("points", fmt.Errorf("odd number of coordinates %d", len(s.Points)))
+	}
+	s.points = transformPoints(append([]float32(nil), s.Points...), s.transformMatrix)
+	return nil
+}
+
+func (s *Polyline) rasterize(r *Rasterizer) error {
+	// The fill is closed back to the first point, the stroke is not.
+	outline := []contour{{points: s.points}}
+	fill, ok, err := r.paint(s.Fill, "black", s.FillOpacity, s.transformMatrix, outline)
+	if err != nil {
+		return s.errorf("fill", err)
+	}
+	if ok {
+		r.fillContours([]contour{{points: s.points, closed: true}}, s.FillRule == "evenodd", fill)
+	}
+
+	stroke, ok, err := r.paint(s.Stroke, "none", s.StrokeOpacity, s.transformMatrix, outline)
+	if err != nil {
+		return s.errorf("stroke", err)
+	}
+	if ok {
+		r.strokeContours(outline, stroke)
+	}
+	return nil
+}
+
+type Polygon struct {
+	transformable
+	Fill          string
+	Stroke        string
+	Points        []float32 // x, y pairs.
+	FillOpacity   float32
+	StrokeOpacity float32
+	FillRule      string    // nonzero or evenodd.
+	points        []float32 // Points in the coordinate space of the document.
+}
+
+// NewPolygon returns an unstroked black polygon with the given vertices,
+// given as x, y pairs.
+func NewPolygon(points ...float32) *Polygon {
+	return &Polygon{Points: points, FillOpacity: 1, StrokeOpacity: 1}
+}
+
+// parseTransform parses a transform list such as
+// "translate(10 20) rotate(45) scale(2)" into a single matrix.
+func parseTransform(trans string) (mgl.Mat3, error) {
+	mat := mgl.Ident3()
+
+	rest := strings.TrimSpace(trans)
+	for rest != "" {
+		open := strings.IndexByte(rest, '(')
+		end := strings.IndexByte(rest, ')')
+		if open < 0 || end < open {
+			return mat, fmt.Errorf("expected name(values...) at %q", rest)
+		}
+
+		name := strings.TrimSpace(rest[:open])
+		args, err := parseNumbers(rest[open+1 : end])
+		if err != nil {
+			return mat, fmt.Errorf("%s: %w", name, err)
+		}
+		m, err := transformFunction(name, args)
+		if err != nil {
+			return mat, err
+		}
+		mat = mat.Mul3(m)
+
+		rest = strings.TrimLeft(rest[end+1:], ", \t\n")
+	}
+
+	return mat, nil
+}
+
+// affine builds the matrix that the svg matrix(a b c d e f) transform
+// describes.
+func affine(a, b, c, d, e, f float32) mgl.Mat3 {
+	mat := mgl.Ident3()
+	mat[0], mat[1] = a, b
+	mat[3], mat[4] = c, d
+	mat[6], mat[7] = e, f
+	return mat
+}
+
+func transformFunction(name string, args []float32) (mgl.Mat3, error) {
+	argCountErr := fmt.Errorf("%s: unexpected number of values %d", name, len(args))
+
+	switch name {
+	case "matrix":
+		if len(args) != 6 {
+			return mgl.Ident3(), argCountErr
+		}
+		return affine(args[0], args[1], args[2], args[3], args[4], args[5]), nil
+	case "translate":
+		switch len(args) {
+		case 1:
+			return mgl.Translate2D(args[0], 0), nil
+		case 2:
+			return mgl.Translate2D(args[0], args[1]), nil
+		}
+	case "scale":
+		switch len(args) {
+		case 1:
+			return mgl.Scale2D(args[0], args[0]), nil
+		case 2:
+			return mgl.Scale2D(args[0], args[1]), nil
+		}
+	case "rotate":
+		if len(args) != 1 && len(args) != 3 {
+			break
+		}
+		sin, cos := math.Sincos(float64(mgl.DegToRad(args[0])))
+		rotate := affine(float32(cos), float32(sin), float32(-sin), float32(cos), 0, 0)
+		if len(args) == 1 {
+			return rotate, nil
+		}
+		// Rotate about the point (cx, cy).
+		cx, cy := args[1], args[2]
+		return mgl.Translate2D(cx, cy).Mul3(rotate).Mul3(mgl.Translate2D(-cx, -cy)), nil
+	case "skewX":
+		if len(args) == 1 {
+			tan := float32(math.Tan(float64(mgl.DegToRad(args[0]))))
+			return affine(1, 0, tan, 1, 0, 0), nil
+		}
+	case "skewY":
+		if len(args) == 1 {
+			tan := float32(math.Tan(float64(mgl.DegToRad(args[0]))))
+			return affine(1, tan, 0, 1, 0, 0), nil
+		}
+	default:
+		return mgl.Ident3(), fmt.Errorf("unknown transform %q", name)
+	}
+	return mgl.Ident3(), argCountErr
+}
+
+// viewBoxTransform maps the viewBox (min-x, min-y, width and height) onto a
+// viewport of the given size as preserveAspectRatio, such as "xMidYMid meet",
+// describes.
+func viewBoxTransform(viewBox []float32, width, height float32, preserveAspectRatio string) (mgl.Mat3, error) {
+	fields := strings.Fields(preserveAspectRatio)
+	if len(fields) > 0 && fields[0] == "defer" {
+		fields = fields[1:]
+	}
+	align, meetOrSlice := "xMidYMid", "meet"
+	switch len(fields) {
+	case 2:
+		meetOrSlice = fields[1]
+		fallthrough
+	case 1:
+		align = fields[0]
+	case 0:
+	default:
+		return mgl.Ident3(), fmt.Errorf("invalid preserveAspectRatio %q", preserveAspectRatio)
+	}
+
+	sx, sy := width/viewBox[2], height/viewBox[3]
+	if align == "none" {
+		return mgl.Translate2D(-viewBox[0]*sx, -viewBox[1]*sy).Mul3(mgl.Scale2D(sx, sy)), nil
+	}
+
+	switch meetOrSlice {
+	case "meet":
+		sx = float32(math.Min(float64(sx), float64(sy)))
+	case "slice":
+		sx = float32(math.Max(float64(sx), float64(sy)))
+	default:
+		return mgl.Ident3(), fmt.Errorf("invalid preserveAspectRatio %q", preserveAspectRatio)
+	}
+	sy = sx
+
+	// align is x followed by Min, Mid or Max then the same for Y.
+	offset := func(position string, extra float32) (float32, bool) {
+		switch position {
+		case "Min":
+			return 0, true
+		case "Mid":
+			return extra / 2, true
+		case "Max":
+			return extra, true
+		}
+		return 0, false
+	}
+	if len(align) != 8 || align[0] != 'x' || align[4] != 'Y' {
+		return mgl.Ident3(), fmt.Errorf("invalid preserveAspectRatio %q", preserveAspectRatio)
+	}
+	tx, okX := offset(align[1:4], width-viewBox[2]*sx)
+	ty, okY := offset(align[5:8], height-viewBox[3]*sy)
+	if !okX || !okY {
+		return mgl.Ident3(), fmt.Errorf("invalid preserveAspectRatio %q", preserveAspectRatio)
+	}
+	return mgl.Translate2D(tx-viewBox[0]*sx, ty-viewBox[1]*sy).Mul3(mgl.Scale2D(sx, sy)), nil
+}
+
+// parseNumbers parses a list of numbers separated by commas or whitespace.
+// Like in path data no separator is needed where a sign or a second decimal
+// point starts the next number, as in "10-5" or "0.5.5".
+func parseNumbers(in string) ([]float32, error) {
+	p := &pathScanner{s: in}
+	var numbers []float32
+	for p.skipSeparators(); p.i < len(p.s); p.skipSeparators() {
+		f, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, f)
+	}
+	return numbers, nil
+}
+
+// parsePoints parses the points attribute of a polygon or polyline.
+func parsePoints(in string) ([]float32, error) {
+	points, err := parseNumbers(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(points)%2 != 0 {
+		return nil, fmt.Errorf("odd number of coordinates %d", len(points))
+	}
+	return points, nil
+}
+
+func (r *Rasterizer) transform(points []float32, trans mgl.Mat3, isAliased bool) []float32 {
+	return r.scalePoints(transformPoints(points, trans), isAliased)
+}
+
+// transformPoints applies trans to a list of x, y pairs in place.
+func transformPoints(points []float32, trans mgl.Mat3) []float32 {
+	for i := 0; i < len(points); i += 2 {
+		transformed := trans.Mul3x1(mgl.Vec3{points[i], points[i+1], 1.0})
+		points[i], points[i+1] = transformed[0], transformed[1]
+	}
+	return points
+}
+
+// scalePoints returns points in the coordinate space of the document scaled
+// onto the pixel grid, or onto the sample grid if isAliased is set.
+func (r *Rasterizer) scalePoints(points []float32, isAliased bool) []float32 {
+	scale := r.scale
+	if isAliased {
+		scale *= float32(r.sampleRate)
+	}
+
+	scaled := make([]float32, len(points))
+	for i, p := range points {
+		scaled[i] = p * scale
+	}
+	return scaled
+}
+
+func (s *Polygon) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	if err := s.checkPaints(s.Fill, s.Stroke); err != nil {
+		return err
+	}
+
+	if len(s.Points)%2 != 0 {
+		return s.errorf("points", fmt.Errorf("odd number of coordinates %d", len(s.Points)))
+	}
+	s.points = transformPoints(append([]float32(nil), s.Points...), s.transformMatrix)
+	return nil
+}
+
+func (s *Polygon) rasterize(r *Rasterizer) error {
+	contours := []contour{{points: s.points, closed: true}}
+
+	fill, ok, err := r.paint(s.Fill, "black", s.FillOpacity, s.transformMatrix, contours)
+	if err != nil {
+		return s.errorf("fill", err)
+	}
+	if ok {
+		r.fillContours(contours, s.FillRule == "evenodd", fill)
+	}
+
+	stroke, ok, err := r.paint(s.Stroke, "none", s.StrokeOpacity, s.transformMatrix, contours)
+	if err != nil {
+		return s.errorf("stroke", err)
+	}
+	if ok {
+		r.strokeContours(contours, stroke)
+	}
+	return nil
+}
+
+func (s *Svg) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+	return s.compileChildren(c)
+}
+
+func (s *Svg) compileChildren(c *compiler) error {
+	for id, p := range s.paintServers {
+		if c.paintServers == nil {
+			c.paintServers = map[string]PaintServer{}
+		}
+		if _, ok := c.paintServers[id]; !ok {
+			c.paintServers[id] = p
+		}
+	}
+	for _, child := range s.children {
+		if child.base().Display == "none" {
+			continue
+		}
+		if c.compiled[child] {
+			return child.base().errorf("", errors.New("element is in more than one group"))
+		}
+		c.compiled[child] = true
+		if err := child.compile(c, s.transformMatrix); err != nil {
+			return err
+		}
+		if !isGroup(child) {
+			c.elements++
+		}
+	}
+	return nil
+}
+
+// rasterize paints the children that are displayed. Hidden children are
+// still walked since the elements in them can be made visible again.
+func (s *Svg) rasterize(r *Rasterizer) error {
+	for _, child := range s.children {
+		t := child.base()
+		if t.Display == "none" {
+			continue
+		}
+		hidden := r.hidden
+		switch t.Visibility {
+		case "hidden", "collapse":
+			r.hidden = true
+		case "visible":
+			r.hidden = false
+		}
+		err := s.rasterizeChild(r, child)
+		r.hidden = hidden
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Svg) rasterizeChild(r *Rasterizer, child Element) error {
+	if isGroup(child) {
+		return child.rasterize(r)
+	}
+	if !r.hidden {
+		if err := child.rasterize(r); err != nil {
+			return err
+		}
+	}
+	return r.elementDone()
+}
+
+// isGroup reports whether e only holds other elements, which are counted as
+// painted instead of it.
+func isGroup(e Element) bool {
+	switch e.(type) {
+	case *Svg, *Viewport:
+		return true
+	}
+	return false
+}
+
+// Viewport is an svg nested in a document. Its children are drawn in a
+// coordinate system of their own, with the ViewBox stretched over the
+// rectangle at X, Y of size Width by Height, and are clipped to that
+// rectangle unless Overflow is visible.
+type Viewport struct {
+	Svg
+	X        float32
+	Y        float32
+	Overflow string    // visible or auto draw outside of the viewport.
+	clip     []contour // The viewport in the coordinate space of the document.
+	visible  bool
+}
+
+// NewViewport returns an empty viewport at (x, y) of the given size. Without
+// a ViewBox its children are only moved to (x, y).
+func NewViewport(x, y, width, height float32, children ...Element) *Viewport {
+	return &Viewport{Svg: Svg{Width: width, Height: height, children: children},
+		X: x, Y: y}
+}
+
+func (s *Viewport) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+
+	// An empty viewport or viewBox hides everything in it.
+	s.visible = s.Width > 0 && s.Height > 0 &&
+		(s.ViewBox == nil || s.ViewBox[2] > 0 && s.ViewBox[3] > 0)
+	if !s.visible {
+		return nil
+	}
+
+	s.clip = nil
+	if s.Overflow != "visible" && s.Overflow != "auto" {
+		x0, y0, x1, y1 := s.X, s.Y, s.X+s.Width, s.Y+s.Height
+		s.clip = []contour{{
+			points: transformPoints([]float32{x0, y0, x1, y0, x1, y1, x0, y1}, s.transformMatrix),
+			closed: true,
+		}}
+	}
+
+	m := mgl.Translate2D(s.X, s.Y)
+	if s.ViewBox != nil {
+		viewBox, err := viewBoxTransform(s.ViewBox, s.Width, s.Height, s.PreserveAspectRatio)
+		if err != nil {
+			return s.errorf("preserveAspectRatio", err)
+		}
+		m = m.Mul3(viewBox)
+	}
+	s.transformMatrix = s.transformMatrix.Mul3(m)
+	return s.compileChildren(c)
+}
+
+func (s *Viewport) rasterize(r *Rasterizer) error {
+	if !s.visible {
+		return nil
+	}
+	if s.clip != nil {
+		previous := r.pushClip(s.clip)
+		defer r.popClip(previous)
+	}
+	return s.Svg.rasterize(r)
+}
@@ -0,0 +1,89 @@
+package rasterizer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseNumbers(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []float32
+	}{
+		{"", nil},
+		{" \t\n", nil},
+		{"1 2", []float32{1, 2}},
+		{"1,2", []float32{1, 2}},
+		{"1, 2 ,3", []float32{1, 2, 3}},
+		{"  1\n\n2\t\t3  ", []float32{1, 2, 3}},
+		{"10-5", []float32{10, -5}},
+		{"-1-2+3", []float32{-1, -2, 3}},
+		{"0.5.5", []float32{0.5, 0.5}},
+		{".5-.5", []float32{0.5, -0.5}},
+		{"1e-3", []float32{0.001}},
+		{"1E2", []float32{100}},
+		{"1e+2-1e-2", []float32{100, -0.01}},
+		{"2.5e1.5", []float32{25, 0.5}},
+	} {
+		got, err := parseNumbers(test.in)
+		if err != nil {
+			t.Errorf("parseNumbers(%q) returned error %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseNumbers(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseNumbersErrors(t *testing.T) {
+	for _, in := range []string{"a", "1 b", "1,-", "1 . 2", "--1", "1e"} {
+		if got, err := parseNumbers(in); err == nil {
+			t.Errorf("parseNumbers(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	got, err := parsePoints("0,0 10-5\n1e1,20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{0, 0, 10, -5, 10, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePoints = %v, want %v", got, want)
+	}
+
+	if _, err := parsePoints("0,0 10"); err == nil {
+		t.Error("parsePoints with an odd number of coordinates returned no error")
+	}
+}
+
+func TestSetSceneErrors(t *testing.T) {
+	shared := NewRect(0, 0, 1, 1)
+	bogus := NewRect(0, 0, 1, 1)
+	bogus.Fill = "bogus"
+	line := NewLine(0, 0, 1, 1)
+	line.Stroke = "url(#a) bogus"
+	for _, test := range []struct {
+		name  string
+		scene *Svg
+		want  string
+	}{
+		{"shared", document(shared, NewGroup(shared)), "element is in more than one group"},
+		{"fill", document(bogus), `fill: invalid color "bogus"`},
+		{"stroke", document(NewGroup(line)), `stroke: invalid color "bogus"`},
+	} {
+		err := New().SetScene(test.scene)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || err.Error() != test.want {
+			t.Errorf("%s: SetScene returned %v, want a *ParseError %q", test.name, err, test.want)
+		}
+	}
+}
+
+func document(children ...Element) *Svg {
+	s := NewDocument(10, 10)
+	s.Add(children...)
+	return s
+}
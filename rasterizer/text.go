@@ -0,0 +1,350 @@
+package rasterizer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Text is a <text> element. Its glyphs come from the outlines of the fonts
+// given to LoadFonts, or a bundled font, and are filled like any path.
+type Text struct {
+	transformable
+	TextSpan
+	FillOpacity   float32
+	StrokeOpacity float32
+	runs          []glyphRun
+}
+
+// TextSpan is the text of a <text> or a <tspan> in it, followed by the spans
+// nested in it. Fields left at their zero value take the value of the span
+// around it.
+type TextSpan struct {
+	Text       string
+	X          []float32 // Where each character starts, as far as the list goes.
+	Y          []float32
+	DX         []float32 // How far to move each character, as far as the list goes.
+	DY         []float32
+	FontFamily string  // A list such as "Helvetica, Arial, sans-serif".
+	FontSize   float32 // 16 at the outermost span when not given.
+	FontWeight int     // From 1 to 1000, normal being 400 and bold 700.
+	TextAnchor string  // start, middle or end.
+	Fill       string
+	Stroke     string
+	children   []*TextSpan
+	zeroSize   bool // A font-size of 0 was given, which hides the span.
+}
+
+// NewText returns black text starting at (x, y), y being the baseline.
+func NewText(x, y float32, text string) *Text {
+	return &Text{
+		TextSpan:    TextSpan{Text: text, X: []float32{x}, Y: []float32{y}},
+		FillOpacity: 1, StrokeOpacity: 1,
+	}
+}
+
+// NewTextSpan returns a span that takes everything but its text from the span
+// it is added to.
+func NewTextSpan(text string) *TextSpan {
+	return &TextSpan{Text: text}
+}
+
+// Add appends spans after the text of s and the spans already in it.
+func (s *TextSpan) Add(spans ...*TextSpan) {
+	s.children = append(s.children, spans...)
+}
+
+// textStyle is what a span ends up with once inherited values are filled in.
+type textStyle struct {
+	family string
+	size   float32
+	weight int
+	anchor string
+	fill   string
+	stroke string
+}
+
+func (s *TextSpan) style(parent textStyle) textStyle {
+	if s.FontFamily != "" {
+		parent.family = s.FontFamily
+	}
+	if s.FontSize != 0 || s.zeroSize {
+		parent.size = s.FontSize
+	}
+	if s.FontWeight != 0 {
+		parent.weight = s.FontWeight
+	}
+	if s.TextAnchor != "" {
+		parent.anchor = s.TextAnchor
+	}
+	if s.Fill != "" {
+		parent.fill = s.Fill
+	}
+	if s.Stroke != "" {
+		parent.stroke = s.Stroke
+	}
+	return parent
+}
+
+// glyphRun is consecutive glyphs painted the same way.
+type glyphRun struct {
+	fill     string
+	stroke   string
+	contours []contour // In the coordinate space of the document.
+}
+
+type placedGlyph struct {
+	face  *fontFace
+	index sfnt.GlyphIndex
+	x, y  float32 // Origin of the glyph on the baseline.
+	size  float32
+	run   int
+}
+
+// textChunk is glyphs anchored together. A chunk starts at every character
+// given an absolute position.
+type textChunk struct {
+	first      int // Index of the first glyph.
+	anchor     string
+	start, end float32
+}
+
+// textLayout places the characters of the spans of a text one after another.
+type textLayout struct {
+	fonts      []*fontFace
+	buf        sfnt.Buffer
+	glyphs     []placedGlyph
+	chunks     []textChunk
+	runs       []glyphRun
+	positioned []positionedSpan // The spans around the current one, innermost last.
+	chars      int
+	x, y       float32
+	previous   int // Index of the glyph to kern against, -1 at the start of a chunk.
+}
+
+type positionedSpan struct {
+	span  *TextSpan
+	start int // Index of the first character of the span.
+}
+
+func (l *textLayout) span(s *TextSpan, style textStyle) error {
+	style = s.style(style)
+	face := matchFont(l.fonts, style.family, style.weight)
+
+	l.positioned = append(l.positioned, positionedSpan{s, l.chars})
+	defer func() { l.positioned = l.positioned[:len(l.positioned)-1] }()
+
+	for _, r := range s.Text {
+		if err := l.char(r, face, style); err != nil {
+			return err
+		}
+	}
+	for _, child := range s.children {
+		if err := l.span(child, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// position returns the value that the innermost span with one gives for
+// character i.
+func (l *textLayout) position(i int, list func(s *TextSpan) []float32) (float32, bool) {
+	for j := len(l.positioned) - 1; j >= 0; j-- {
+		p := l.positioned[j]
+		if values := list(p.span); i-p.start < len(values) {
+			return values[i-p.start], true
+		}
+	}
+	return 0, false
+}
+
+func (l *textLayout) char(r rune, face *fontFace, style textStyle) error {
+	i := l.chars
+	l.chars++
+
+	newChunk := len(l.chunks) == 0
+	if x, ok := l.position(i, func(s *TextSpan) []float32 { return s.X }); ok {
+		l.x, newChunk = x, true
+	}
+	if y, ok := l.position(i, func(s *TextSpan) []float32 { return s.Y }); ok {
+		l.y, newChunk = y, true
+	}
+	if dx, ok := l.position(i, func(s *TextSpan) []float32 { return s.DX }); ok {
+		l.x += dx
+	}
+	if dy, ok := l.position(i, func(s *TextSpan) []float32 { return s.DY }); ok {
+		l.y += dy
+	}
+	if newChunk {
+		l.chunks = append(l.chunks, textChunk{first: len(l.glyphs), anchor: style.anchor, start: l.x})
+		l.previous = -1
+	}
+
+	index, err := face.font.GlyphIndex(&l.buf, r)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		// Characters the font is missing come from the bundled font instead.
+		fallback := closestFace(bundledFonts(), "go", style.weight)
+		if fallbackIndex, err := fallback.font.GlyphIndex(&l.buf, r); err == nil && fallbackIndex != 0 {
+			face, index = fallback, fallbackIndex
+		}
+	}
+	f := face.font
+	unitsPerEm := fixed.I(int(f.UnitsPerEm()))
+	scale := style.size / float32(unitsPerEm)
+	if l.previous >= 0 && l.glyphs[l.previous].face == face {
+		p := l.glyphs[l.previous]
+		// Fonts without kerning report an error, which is the same as none.
+		if kern, err := f.Kern(&l.buf, p.index, index, unitsPerEm, font.HintingNone); err == nil {
+			l.x += float32(kern) * scale
+		}
+	}
+
+	if n := len(l.runs); n == 0 || l.runs[n-1].fill != style.fill || l.runs[n-1].stroke != style.stroke {
+		l.runs = append(l.runs, glyphRun{fill: style.fill, stroke: style.stroke})
+	}
+	l.glyphs = append(l.glyphs, placedGlyph{
+		face: face, index: index, x: l.x, y: l.y, size: style.size, run: len(l.runs) - 1,
+	})
+	l.previous = len(l.glyphs) - 1
+
+	advance, err := f.GlyphAdvance(&l.buf, index, unitsPerEm, font.HintingNone)
+	if err != nil {
+		return err
+	}
+	l.x += float32(advance) * scale
+	l.chunks[len(l.chunks)-1].end = l.x
+	return nil
+}
+
+// anchor moves the glyphs of every chunk so that the chunk starts, is
+// centered on or ends at where its first character was placed.
+func (l *textLayout) anchor() {
+	for i, chunk := range l.chunks {
+		var shift float32
+		switch chunk.anchor {
+		case "middle":
+			shift = (chunk.start - chunk.end) / 2
+		case "end":
+			shift = chunk.start - chunk.end
+		}
+		last := len(l.glyphs)
+		if i+1 < len(l.chunks) {
+			last = l.chunks[i+1].first
+		}
+		for j := chunk.first; j < last; j++ {
+			l.glyphs[j].x += shift
+		}
+	}
+}
+
+// outline returns the outline of g in user space.
+func (l *textLayout) outline(g placedGlyph) ([]pathCommand, error) {
+	f := g.face.font
+	unitsPerEm := fixed.I(int(f.UnitsPerEm()))
+	segments, err := f.LoadGlyph(&l.buf, g.index, unitsPerEm, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := g.size / float32(unitsPerEm)
+	point := func(p fixed.Point26_6) (float32, float32) {
+		return g.x + float32(p.X)*scale, g.y + float32(p.Y)*scale
+	}
+	var commands []pathCommand
+	for _, segment := range segments {
+		var cmd pathCommand
+		a := segment.Args
+		switch segment.Op {
+		case sfnt.SegmentOpMoveTo:
+			if len(commands) > 0 {
+				commands = append(commands, pathCommand{op: 'Z'})
+			}
+			cmd.op = 'M'
+			cmd.args[0], cmd.args[1] = point(a[0])
+		case sfnt.SegmentOpLineTo:
+			cmd.op = 'L'
+			cmd.args[0], cmd.args[1] = point(a[0])
+		case sfnt.SegmentOpQuadTo:
+			cmd.op = 'Q'
+			cmd.args[0], cmd.args[1] = point(a[0])
+			cmd.args[2], cmd.args[3] = point(a[1])
+		case sfnt.SegmentOpCubeTo:
+			cmd.op = 'C'
+			cmd.args[0], cmd.args[1] = point(a[0])
+			cmd.args[2], cmd.args[3] = point(a[1])
+			cmd.args[4], cmd.args[5] = point(a[2])
+		}
+		commands = append(commands, cmd)
+	}
+	if len(commands) > 0 {
+		commands = append(commands, pathCommand{op: 'Z'})
+	}
+	return commands, nil
+}
+
+func (s *Text) compile(c *compiler, parent mgl.Mat3) error {
+	if err := s.transformable.compile(c, parent); err != nil {
+		return err
+	}
+
+	l := &textLayout{fonts: c.fonts}
+	style := textStyle{size: 16, weight: 400, anchor: "start"}
+	if err := l.span(&s.TextSpan, style); err != nil {
+		return s.errorf("font-family", err)
+	}
+	l.anchor()
+	for _, run := range l.runs {
+		if err := s.checkPaints(run.fill, run.stroke); err != nil {
+			return err
+		}
+	}
+
+	tolerance := userTolerance(s.transformMatrix)
+	for _, g := range l.glyphs {
+		if g.size == 0 {
+			continue
+		}
+		commands, err := l.outline(g)
+		if err != nil {
+			return s.errorf("font-family", err)
+		}
+		contours := flattenPath(commands, tolerance)
+		for _, c := range contours {
+			transformPoints(c.points, s.transformMatrix)
+		}
+		l.runs[g.run].contours = append(l.runs[g.run].contours, contours...)
+	}
+	s.runs = l.runs
+	return nil
+}
+
+func (s *Text) rasterize(r *Rasterizer) error {
+	// Gradients span the whole of the text rather than each run.
+	var outline []contour
+	for _, run := range s.runs {
+		outline = append(outline, run.contours...)
+	}
+	for _, run := range s.runs {
+		fill, ok, err := r.paint(run.fill, "black", s.FillOpacity, s.transformMatrix, outline)
+		if err != nil {
+			return s.errorf("fill", err)
+		}
+		if ok {
+			r.fillContours(run.contours, false, fill)
+		}
+
+		stroke, ok, err := r.paint(run.stroke, "none", s.StrokeOpacity, s.transformMatrix, outline)
+		if err != nil {
+			return s.errorf("stroke", err)
+		}
+		if ok {
+			r.strokeContours(run.contours, stroke)
+		}
+	}
+	return nil
+}